@@ -0,0 +1,120 @@
+// Package audit keeps the append-only trail of privileged admin actions.
+//
+// The audit middleware opens an Entry for every admin request and writes it
+// once the handler has finished. Handlers fill in what only they know: a
+// meaningful action name, the account the action was aimed at and the state
+// before and after the change.
+package audit
+
+import (
+	"encoding/json"
+	model "final-project/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const contextKey = "audit_entry"
+
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+	OutcomeDenied  = "denied"
+)
+
+// Entry collects the details of one audited request while it is handled.
+type Entry struct {
+	Action    string
+	Target_Id *int64
+	Before    interface{}
+	After     interface{}
+}
+
+// Begin attaches a fresh entry to the request. The action defaults to the
+// method and route until a handler names it.
+func Begin(ctx *gin.Context) *Entry {
+	entry := &Entry{Action: ctx.Request.Method + " " + ctx.FullPath()}
+	ctx.Set(contextKey, entry)
+	return entry
+}
+
+func current(ctx *gin.Context) *Entry {
+	if value, ok := ctx.Get(contextKey); ok {
+		if entry, ok := value.(*Entry); ok {
+			return entry
+		}
+	}
+	return nil
+}
+
+// Describe names the action and the account it targets.
+func Describe(ctx *gin.Context, action string, targetId int64) {
+	if entry := current(ctx); entry != nil {
+		entry.Action = action
+		if targetId != 0 {
+			entry.Target_Id = &targetId
+		}
+	}
+}
+
+// Change records the state before and after the action. Either side may be
+// nil when the action creates or removes something.
+func Change(ctx *gin.Context, before interface{}, after interface{}) {
+	if entry := current(ctx); entry != nil {
+		entry.Before = before
+		entry.After = after
+	}
+}
+
+// Outcome classifies a finished request by its status code.
+func Outcome(status int) string {
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return OutcomeDenied
+	case status >= http.StatusBadRequest:
+		return OutcomeFailure
+	default:
+		return OutcomeSuccess
+	}
+}
+
+// Write appends the request's entry to admin_audit_log.
+func Write(db *gorm.DB, ctx *gin.Context) error {
+	entry := current(ctx)
+	if entry == nil {
+		return nil
+	}
+
+	log := model.AdminAuditLog{
+		Actor_Id:          ctx.GetInt64("id"),
+		Action:            entry.Action,
+		Target_Account_Id: entry.Target_Id,
+		Request_Id:        ctx.GetString("request_id"),
+		Ip:                ctx.ClientIP(),
+		Method:            ctx.Request.Method,
+		Path:              ctx.Request.URL.Path,
+		Status_Code:       ctx.Writer.Status(),
+		Outcome:           Outcome(ctx.Writer.Status()),
+		Time_Stamp:        time.Now(),
+	}
+
+	var err error
+	if log.Before_State, err = marshal(entry.Before); err != nil {
+		return err
+	}
+	if log.After_State, err = marshal(entry.After); err != nil {
+		return err
+	}
+
+	return db.Create(&log).Error
+}
+
+func marshal(value interface{}) (json.RawMessage, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	return json.Marshal(value)
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"final-project/loginguard"
+	model "final-project/models"
+	"final-project/outbox"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const commandUsage = `usage: final-project <command> [flags]
+
+commands:
+  migrate up | down [steps] | status
+  create-admin -username NAME -name FULL_NAME [-position POSITION]
+  reset-password -username NAME
+  lock -username NAME
+  unlock -username NAME
+  seed-products
+  replay-outbox [-id ID]
+
+create-admin and reset-password read the new password from stdin.`
+
+// runCommand runs an operations subcommand against the database configured
+// by POSTGRESQL_URI instead of starting the server.
+func runCommand(db *gorm.DB, args []string) {
+	var err error
+
+	switch args[0] {
+	case "migrate":
+		runMigrate(db, args[1:])
+	case "create-admin":
+		err = createAdminCommand(db, args[1:])
+	case "reset-password":
+		err = resetPasswordCommand(db, args[1:])
+	case "lock":
+		err = lockCommand(db, args[1:], true)
+	case "unlock":
+		err = lockCommand(db, args[1:], false)
+	case "seed-products":
+		err = seedProductsCommand(db)
+	case "replay-outbox":
+		err = replayOutboxCommand(db, args[1:])
+	default:
+		log.Fatal(commandUsage)
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func readPassword() (string, error) {
+	fmt.Fprint(os.Stderr, "password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return "", errors.New("password cannot be empty")
+	}
+	return password, nil
+}
+
+func createAdminCommand(db *gorm.DB, args []string) error {
+	flags := flag.NewFlagSet("create-admin", flag.ExitOnError)
+	username := flags.String("username", "", "login name of the admin")
+	name := flags.String("name", "", "full name of the admin")
+	position := flags.String("position", "superadmin", "admin position")
+	flags.Parse(args)
+
+	if *username == "" || *name == "" {
+		return errors.New("create-admin needs -username and -name")
+	}
+
+	password, err := readPassword()
+	if err != nil {
+		return err
+	}
+
+	hashPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		newAccount := model.Account{
+			Username: *username,
+			Password: string(hashPassword),
+			Role:     model.RoleAdmin,
+		}
+		if err := tx.Create(&newAccount).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&model.Admin{
+			Account_Id: newAccount.Id,
+			Name:       *name,
+			Position:   strings.ToLower(*position),
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("created admin %s\n", *username)
+	return nil
+}
+
+func resetPasswordCommand(db *gorm.DB, args []string) error {
+	flags := flag.NewFlagSet("reset-password", flag.ExitOnError)
+	username := flags.String("username", "", "login name of the account")
+	flags.Parse(args)
+
+	account := model.Account{}
+	if err := db.Where("username = ?", *username).First(&account).Error; err != nil {
+		return err
+	}
+
+	password, err := readPassword()
+	if err != nil {
+		return err
+	}
+
+	hashPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&account).Update("password", string(hashPassword)).Error; err != nil {
+			return err
+		}
+		return revokeSessions(tx, account.Id)
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("password reset for %s, existing sessions revoked\n", *username)
+	return nil
+}
+
+// lockCommand locks or unlocks an account. Locking also ends every session
+// so the account is logged out right away; unlocking also clears any
+// failed-login lockout.
+func lockCommand(db *gorm.DB, args []string, lock bool) error {
+	flags := flag.NewFlagSet("lock", flag.ExitOnError)
+	username := flags.String("username", "", "login name of the account")
+	flags.Parse(args)
+
+	account := model.Account{}
+	if err := db.Where("username = ?", *username).First(&account).Error; err != nil {
+		return err
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&account).Update("is_locked", lock).Error; err != nil {
+			return err
+		}
+		if !lock {
+			return loginguard.Reset(tx, loginguard.UserKey(account.Username))
+		}
+		return revokeSessions(tx, account.Id)
+	})
+	if err != nil {
+		return err
+	}
+
+	if lock {
+		fmt.Printf("locked %s\n", *username)
+	} else {
+		fmt.Printf("unlocked %s\n", *username)
+	}
+	return nil
+}
+
+func revokeSessions(tx *gorm.DB, accountId int64) error {
+	return tx.Model(&model.Session{}).Where("account_id = ? AND revoked_at IS NULL", accountId).Update("revoked_at", time.Now()).Error
+}
+
+// defaultProducts are the deposito products the service started with, when
+// their limits were still hard-coded in RegisterDeposit. Migration 0005 seeds
+// the same rows.
+var defaultProducts = []model.DepositProduct{
+	{
+		Code:                     "mini",
+		Name:                     "Deposito Mini",
+		Min_Amount:               100000,
+		Max_Amount:               10000000,
+		Tenors:                   "1,3,6,12",
+		Interest_Rate:            3.0,
+		Early_Withdrawal_Penalty: 1.0,
+	},
+	{
+		Code:                     "maxi",
+		Name:                     "Deposito Maxi",
+		Min_Amount:               100000,
+		Max_Amount:               1000000000,
+		Tenors:                   "3,6,12,24",
+		Interest_Rate:            4.0,
+		Early_Withdrawal_Penalty: 1.5,
+	},
+	{
+		Code:                     "great",
+		Name:                     "Deposito Great",
+		Min_Amount:               1000000000,
+		Max_Amount:               9999999999,
+		Tenors:                   "6,12,24,36",
+		Interest_Rate:            5.0,
+		Early_Withdrawal_Penalty: 2.0,
+	},
+}
+
+// seedProductsCommand inserts the default products. Products that already
+// exist are left untouched, so it is safe to run more than once.
+func seedProductsCommand(db *gorm.DB) error {
+	for _, product := range defaultProducts {
+		product.Is_Active = true
+		product.Time_Stamp = time.Now()
+
+		result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&product)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			fmt.Printf("product %s already exists\n", product.Code)
+		} else {
+			fmt.Printf("seeded product %s\n", product.Code)
+		}
+	}
+	return nil
+}
+
+func replayOutboxCommand(db *gorm.DB, args []string) error {
+	flags := flag.NewFlagSet("replay-outbox", flag.ExitOnError)
+	id := flags.Int64("id", 0, "outbox message to replay, every failed message when omitted")
+	flags.Parse(args)
+
+	ids := []int64{*id}
+	if *id == 0 {
+		ids = nil
+		if err := db.Model(&model.Outbox{}).Where("status = ?", model.OutboxStatusFailed).Order("id").Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+	}
+
+	for _, id := range ids {
+		if err := outbox.Replay(db, id); err != nil {
+			fmt.Printf("outbox %d: %v\n", id, err)
+			continue
+		}
+		fmt.Printf("outbox %d queued for delivery\n", id)
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package database
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Version    int        `json:"version"`
+	Name       string     `json:"name"`
+	Applied_At *time.Time `json:"applied_at"`
+}
+
+type schemaMigration struct {
+	Version    int `gorm:"primaryKey"`
+	Name       string
+	Applied_At time.Time
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Migrations lists the embedded migrations in version order. Files are named
+// NNNN_name.up.sql and NNNN_name.down.sql.
+func Migrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		file := entry.Name()
+		base, direction, ok := strings.Cut(strings.TrimSuffix(file, ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("migration %s: expected NNNN_name.up.sql or NNNN_name.down.sql", file)
+		}
+
+		prefix, name, _ := strings.Cut(base, "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: invalid version: %w", file, err)
+		}
+
+		content, err := migrationFiles.ReadFile("migrations/" + file)
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		}
+		if direction == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s: missing up or down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+func applied(db *gorm.DB) (map[int]schemaMigration, error) {
+	if err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		name       TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`).Error; err != nil {
+		return nil, err
+	}
+
+	var rows []schemaMigration
+	if err := db.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	versions := map[int]schemaMigration{}
+	for _, row := range rows {
+		versions[row.Version] = row
+	}
+	return versions, nil
+}
+
+// MigrateUp applies every pending migration, each in its own transaction,
+// and returns the versions it applied.
+func MigrateUp(db *gorm.DB) ([]int, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	done, err := applied(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []int
+	for _, migration := range migrations {
+		if _, ok := done[migration.Version]; ok {
+			continue
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(migration.Up).Error; err != nil {
+				return err
+			}
+			return tx.Create(&schemaMigration{
+				Version:    migration.Version,
+				Name:       migration.Name,
+				Applied_At: time.Now(),
+			}).Error
+		})
+		if err != nil {
+			return versions, fmt.Errorf("migration %04d_%s: %w", migration.Version, migration.Name, err)
+		}
+		versions = append(versions, migration.Version)
+	}
+
+	return versions, nil
+}
+
+// MigrateDown reverts the last steps applied migrations and returns the
+// versions it reverted.
+func MigrateDown(db *gorm.DB, steps int) ([]int, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	done, err := applied(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []int
+	for i := len(migrations) - 1; i >= 0 && len(versions) < steps; i-- {
+		migration := migrations[i]
+		if _, ok := done[migration.Version]; !ok {
+			continue
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(migration.Down).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&schemaMigration{}, "version = ?", migration.Version).Error
+		})
+		if err != nil {
+			return versions, fmt.Errorf("migration %04d_%s: %w", migration.Version, migration.Name, err)
+		}
+		versions = append(versions, migration.Version)
+	}
+
+	return versions, nil
+}
+
+// MigrationState reports every embedded migration and when it was applied.
+func MigrationState(db *gorm.DB) ([]MigrationStatus, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	done, err := applied(db)
+	if err != nil {
+		return nil, err
+	}
+
+	status := make([]MigrationStatus, len(migrations))
+	for i, migration := range migrations {
+		status[i] = MigrationStatus{
+			Version: migration.Version,
+			Name:    migration.Name,
+		}
+		if row, ok := done[migration.Version]; ok {
+			appliedAt := row.Applied_At
+			status[i].Applied_At = &appliedAt
+		}
+	}
+
+	return status, nil
+}
@@ -0,0 +1,17 @@
+-- These tables may have been adopted rather than created by 0001, and they
+-- hold every customer's data, so reverting keeps them and only drops the
+-- constraints and indexes 0001 added.
+DROP INDEX IF EXISTS transaction_history_reference_idx;
+DROP INDEX IF EXISTS transaction_history_time_stamp_idx;
+DROP INDEX IF EXISTS transaction_history_account_id_idx;
+
+ALTER TABLE transaction_history DROP CONSTRAINT IF EXISTS transaction_history_in_out_check;
+ALTER TABLE transaction_history DROP CONSTRAINT IF EXISTS transaction_history_amount_check;
+ALTER TABLE transaction_history DROP CONSTRAINT IF EXISTS transaction_history_account_id_fkey;
+ALTER TABLE admin DROP CONSTRAINT IF EXISTS admin_account_id_fkey;
+ALTER TABLE admin DROP CONSTRAINT IF EXISTS admin_account_id_key;
+ALTER TABLE "user" DROP CONSTRAINT IF EXISTS user_balance_check;
+ALTER TABLE "user" DROP CONSTRAINT IF EXISTS user_account_id_fkey;
+ALTER TABLE "user" DROP CONSTRAINT IF EXISTS user_account_id_key;
+ALTER TABLE account DROP CONSTRAINT IF EXISTS account_role_check;
+ALTER TABLE account DROP CONSTRAINT IF EXISTS account_username_key;
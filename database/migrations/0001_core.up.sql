@@ -0,0 +1,86 @@
+-- These tables predate the migrations, so an existing database is adopted:
+-- tables are only created when missing, and what the old schema lacks is
+-- added below.
+CREATE TABLE IF NOT EXISTS account (
+    id         BIGSERIAL PRIMARY KEY,
+    username   TEXT NOT NULL,
+    password   TEXT NOT NULL,
+    role       INTEGER NOT NULL DEFAULT 0 CHECK (role IN (0, 1)),
+    CONSTRAINT account_username_key UNIQUE (username)
+);
+
+CREATE TABLE IF NOT EXISTS "user" (
+    id             BIGSERIAL PRIMARY KEY,
+    account_id     BIGINT NOT NULL REFERENCES account (id) ON DELETE CASCADE,
+    account_number BIGSERIAL NOT NULL,
+    name           TEXT NOT NULL DEFAULT '',
+    address        TEXT NOT NULL DEFAULT '',
+    id_card        BIGINT NOT NULL DEFAULT 0,
+    mothers_name   TEXT NOT NULL DEFAULT '',
+    date_of_birth  TIMESTAMPTZ,
+    gender         TEXT NOT NULL DEFAULT '',
+    balance        BIGINT NOT NULL DEFAULT 0 CHECK (balance >= 0),
+    CONSTRAINT user_account_id_key UNIQUE (account_id),
+    CONSTRAINT user_account_number_key UNIQUE (account_number)
+);
+
+CREATE TABLE IF NOT EXISTS admin (
+    id         BIGSERIAL PRIMARY KEY,
+    account_id BIGINT NOT NULL REFERENCES account (id) ON DELETE CASCADE,
+    name       TEXT NOT NULL DEFAULT '',
+    position   TEXT NOT NULL DEFAULT '',
+    CONSTRAINT admin_account_id_key UNIQUE (account_id)
+);
+
+CREATE TABLE IF NOT EXISTS transaction_history (
+    id                   BIGSERIAL PRIMARY KEY,
+    account_id           BIGINT NOT NULL REFERENCES account (id),
+    transaction_category TEXT NOT NULL,
+    amount               BIGINT NOT NULL CHECK (amount >= 0),
+    in_out               INTEGER NOT NULL CHECK (in_out IN (0, 1)),
+    reference            TEXT NOT NULL DEFAULT '',
+    time_stamp           TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+ALTER TABLE transaction_history ADD COLUMN IF NOT EXISTS reference TEXT NOT NULL DEFAULT '';
+
+-- Adopted tables get the same keys, references and checks as new ones, under
+-- the names Postgres gives the inline constraints above. Existing rows that
+-- break one have to be fixed before the migration can be applied.
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'account_role_check') THEN
+        ALTER TABLE account ADD CONSTRAINT account_role_check CHECK (role IN (0, 1));
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'user_account_id_fkey') THEN
+        ALTER TABLE "user" ADD CONSTRAINT user_account_id_fkey FOREIGN KEY (account_id) REFERENCES account (id) ON DELETE CASCADE;
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'user_balance_check') THEN
+        ALTER TABLE "user" ADD CONSTRAINT user_balance_check CHECK (balance >= 0);
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'admin_account_id_fkey') THEN
+        ALTER TABLE admin ADD CONSTRAINT admin_account_id_fkey FOREIGN KEY (account_id) REFERENCES account (id) ON DELETE CASCADE;
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'transaction_history_account_id_fkey') THEN
+        ALTER TABLE transaction_history ADD CONSTRAINT transaction_history_account_id_fkey FOREIGN KEY (account_id) REFERENCES account (id);
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'transaction_history_amount_check') THEN
+        ALTER TABLE transaction_history ADD CONSTRAINT transaction_history_amount_check CHECK (amount >= 0);
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'transaction_history_in_out_check') THEN
+        ALTER TABLE transaction_history ADD CONSTRAINT transaction_history_in_out_check CHECK (in_out IN (0, 1));
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'account_username_key') THEN
+        ALTER TABLE account ADD CONSTRAINT account_username_key UNIQUE (username);
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'user_account_id_key') THEN
+        ALTER TABLE "user" ADD CONSTRAINT user_account_id_key UNIQUE (account_id);
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'admin_account_id_key') THEN
+        ALTER TABLE admin ADD CONSTRAINT admin_account_id_key UNIQUE (account_id);
+    END IF;
+END $$;
+
+CREATE INDEX IF NOT EXISTS transaction_history_account_id_idx ON transaction_history (account_id);
+CREATE INDEX IF NOT EXISTS transaction_history_time_stamp_idx ON transaction_history (account_id, time_stamp DESC, id DESC);
+CREATE INDEX IF NOT EXISTS transaction_history_reference_idx ON transaction_history (reference) WHERE reference <> '';
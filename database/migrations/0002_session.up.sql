@@ -0,0 +1,21 @@
+CREATE TABLE session (
+    id         TEXT PRIMARY KEY,
+    account_id BIGINT NOT NULL REFERENCES account (id) ON DELETE CASCADE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ,
+    time_stamp TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX session_account_id_idx ON session (account_id);
+
+CREATE TABLE refresh_token (
+    id         BIGSERIAL PRIMARY KEY,
+    session_id TEXT NOT NULL REFERENCES session (id) ON DELETE CASCADE,
+    token_hash TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at    TIMESTAMPTZ,
+    time_stamp TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CONSTRAINT refresh_token_token_hash_key UNIQUE (token_hash)
+);
+
+CREATE INDEX refresh_token_session_id_idx ON refresh_token (session_id);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS posting;
+DROP FUNCTION IF EXISTS posting_check_balanced();
+DROP TABLE IF EXISTS journal_entry;
@@ -0,0 +1,37 @@
+CREATE TABLE journal_entry (
+    id         BIGSERIAL PRIMARY KEY,
+    category   TEXT NOT NULL,
+    reference  TEXT NOT NULL DEFAULT '',
+    time_stamp TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX journal_entry_reference_idx ON journal_entry (reference);
+CREATE INDEX journal_entry_time_stamp_idx ON journal_entry (time_stamp);
+
+CREATE TABLE posting (
+    id               BIGSERIAL PRIMARY KEY,
+    journal_entry_id BIGINT NOT NULL REFERENCES journal_entry (id),
+    ledger_account   TEXT NOT NULL,
+    account_id       BIGINT REFERENCES account (id),
+    amount           BIGINT NOT NULL CHECK (amount <> 0)
+);
+
+CREATE INDEX posting_journal_entry_id_idx ON posting (journal_entry_id);
+CREATE INDEX posting_account_id_idx ON posting (account_id) WHERE account_id IS NOT NULL;
+CREATE INDEX posting_ledger_account_idx ON posting (ledger_account);
+
+-- Postings of an entry must net to zero. The check is deferred to commit so
+-- the postings can be inserted one by one.
+CREATE FUNCTION posting_check_balanced() RETURNS trigger AS $$
+BEGIN
+    IF (SELECT COALESCE(SUM(amount), 0) FROM posting WHERE journal_entry_id = NEW.journal_entry_id) <> 0 THEN
+        RAISE EXCEPTION 'journal entry % is not balanced', NEW.journal_entry_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE CONSTRAINT TRIGGER posting_balanced
+    AFTER INSERT OR UPDATE ON posting
+    DEFERRABLE INITIALLY DEFERRED
+    FOR EACH ROW EXECUTE FUNCTION posting_check_balanced();
@@ -0,0 +1,11 @@
+CREATE TABLE idempotency_key (
+    id            BIGSERIAL PRIMARY KEY,
+    account_id    BIGINT NOT NULL REFERENCES account (id) ON DELETE CASCADE,
+    route         TEXT NOT NULL,
+    key           TEXT NOT NULL,
+    request_hash  TEXT NOT NULL,
+    status_code   INTEGER NOT NULL DEFAULT 0,
+    response_body TEXT NOT NULL DEFAULT '',
+    time_stamp    TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CONSTRAINT idempotency_key_account_id_route_key_key UNIQUE (account_id, route, key)
+);
@@ -0,0 +1,16 @@
+DROP TABLE IF EXISTS deposit_accrual;
+DROP TABLE IF EXISTS deposit_contract;
+
+-- deposit_history may have been adopted rather than created, so only what
+-- 0005 added to it is dropped.
+DROP INDEX IF EXISTS deposit_history_status_idx;
+DROP INDEX IF EXISTS deposit_history_time_stamp_idx;
+DROP INDEX IF EXISTS deposit_history_account_id_idx;
+ALTER TABLE deposit_history DROP CONSTRAINT IF EXISTS deposit_history_deposit_id_fkey;
+ALTER TABLE deposit_history DROP COLUMN IF EXISTS status;
+ALTER TABLE deposit_history DROP COLUMN IF EXISTS rolled_from_id;
+ALTER TABLE deposit_history DROP COLUMN IF EXISTS rollover;
+ALTER TABLE deposit_history DROP COLUMN IF EXISTS interest_rate;
+ALTER TABLE deposit_history DROP COLUMN IF EXISTS contract_id;
+
+DROP TABLE IF EXISTS deposit_product;
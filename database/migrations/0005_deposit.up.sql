@@ -0,0 +1,90 @@
+CREATE TABLE deposit_product (
+    id                       BIGSERIAL PRIMARY KEY,
+    code                     TEXT NOT NULL,
+    name                     TEXT NOT NULL,
+    min_amount               BIGINT NOT NULL CHECK (min_amount > 0),
+    max_amount               BIGINT NOT NULL,
+    tenors                   TEXT NOT NULL,
+    interest_rate            DOUBLE PRECISION NOT NULL DEFAULT 0 CHECK (interest_rate >= 0),
+    early_withdrawal_penalty DOUBLE PRECISION NOT NULL DEFAULT 0 CHECK (early_withdrawal_penalty BETWEEN 0 AND 100),
+    is_active                BOOLEAN NOT NULL DEFAULT TRUE,
+    time_stamp               TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CONSTRAINT deposit_product_code_key UNIQUE (code),
+    CONSTRAINT deposit_product_amount_range CHECK (max_amount >= min_amount)
+);
+
+-- Default products, so registrations work on a freshly migrated database.
+-- The seed-products command inserts the same rows.
+INSERT INTO deposit_product (code, name, min_amount, max_amount, tenors, interest_rate, early_withdrawal_penalty) VALUES
+    ('mini', 'Deposito Mini', 100000, 10000000, '1,3,6,12', 3.0, 1.0),
+    ('maxi', 'Deposito Maxi', 100000, 1000000000, '3,6,12,24', 4.0, 1.5),
+    ('great', 'Deposito Great', 1000000000, 9999999999, '6,12,24,36', 5.0, 2.0)
+ON CONFLICT (code) DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS deposit_history (
+    id             BIGSERIAL PRIMARY KEY,
+    deposit_id     TEXT NOT NULL CONSTRAINT deposit_history_deposit_id_fkey REFERENCES deposit_product (code) ON UPDATE CASCADE,
+    contract_id    TEXT NOT NULL DEFAULT '',
+    account_id     BIGINT NOT NULL REFERENCES account (id),
+    deposit_name   TEXT NOT NULL DEFAULT '',
+    amount         BIGINT NOT NULL CHECK (amount > 0),
+    time_period    INTEGER NOT NULL CHECK (time_period > 0),
+    interest_rate  DOUBLE PRECISION NOT NULL DEFAULT 0,
+    rollover       TEXT NOT NULL DEFAULT 'none' CHECK (rollover IN ('none', 'principal', 'principal_interest')),
+    rolled_from_id BIGINT REFERENCES deposit_history (id),
+    status         TEXT NOT NULL CHECK (status IN ('reserved', 'active', 'released', 'matured', 'closed')),
+    time_stamp     TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- deposit_history predates the migrations. Rows from before are bookings the
+-- external service owns and that never moved wallet funds, so they are
+-- closed to keep the scheduler from paying them out.
+ALTER TABLE deposit_history ADD COLUMN IF NOT EXISTS contract_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE deposit_history ADD COLUMN IF NOT EXISTS interest_rate DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE deposit_history ADD COLUMN IF NOT EXISTS rollover TEXT NOT NULL DEFAULT 'none' CHECK (rollover IN ('none', 'principal', 'principal_interest'));
+ALTER TABLE deposit_history ADD COLUMN IF NOT EXISTS rolled_from_id BIGINT REFERENCES deposit_history (id);
+ALTER TABLE deposit_history ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'closed' CHECK (status IN ('reserved', 'active', 'released', 'matured', 'closed'));
+ALTER TABLE deposit_history ALTER COLUMN status DROP DEFAULT;
+
+-- Old rows may name products that were never in deposit_product, so on an
+-- adopted table the reference is only enforced for new rows.
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'deposit_history_deposit_id_fkey') THEN
+        ALTER TABLE deposit_history ADD CONSTRAINT deposit_history_deposit_id_fkey
+            FOREIGN KEY (deposit_id) REFERENCES deposit_product (code) ON UPDATE CASCADE NOT VALID;
+    END IF;
+END $$;
+
+CREATE INDEX IF NOT EXISTS deposit_history_account_id_idx ON deposit_history (account_id);
+CREATE INDEX IF NOT EXISTS deposit_history_time_stamp_idx ON deposit_history (time_stamp);
+CREATE INDEX IF NOT EXISTS deposit_history_status_idx ON deposit_history (status);
+
+CREATE TABLE deposit_contract (
+    id            BIGSERIAL PRIMARY KEY,
+    contract_id   TEXT NOT NULL,
+    reference     TEXT NOT NULL DEFAULT '',
+    deposit_id    TEXT NOT NULL,
+    account_id    BIGINT NOT NULL REFERENCES account (id),
+    name          TEXT NOT NULL DEFAULT '',
+    amount        BIGINT NOT NULL CHECK (amount > 0),
+    tenor_months  INTEGER NOT NULL CHECK (tenor_months > 0),
+    interest_rate DOUBLE PRECISION NOT NULL DEFAULT 0,
+    start_date    TIMESTAMPTZ NOT NULL,
+    maturity_date TIMESTAMPTZ NOT NULL,
+    status        TEXT NOT NULL CHECK (status IN ('active', 'matured', 'closed')),
+    time_stamp    TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CONSTRAINT deposit_contract_contract_id_key UNIQUE (contract_id)
+);
+
+CREATE INDEX deposit_contract_account_id_idx ON deposit_contract (account_id);
+CREATE UNIQUE INDEX deposit_contract_reference_key ON deposit_contract (reference) WHERE reference <> '';
+
+CREATE TABLE deposit_accrual (
+    id                 BIGSERIAL PRIMARY KEY,
+    deposit_history_id BIGINT NOT NULL REFERENCES deposit_history (id),
+    accrual_date       DATE NOT NULL,
+    amount             BIGINT NOT NULL CHECK (amount >= 0),
+    time_stamp         TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CONSTRAINT deposit_accrual_deposit_history_id_accrual_date_key UNIQUE (deposit_history_id, accrual_date)
+);
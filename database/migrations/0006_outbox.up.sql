@@ -0,0 +1,16 @@
+CREATE TABLE outbox (
+    id              BIGSERIAL PRIMARY KEY,
+    event_type      TEXT NOT NULL,
+    aggregate_id    BIGINT NOT NULL,
+    dedup_key       TEXT NOT NULL,
+    payload         TEXT NOT NULL,
+    status          TEXT NOT NULL CHECK (status IN ('pending', 'sent', 'failed')),
+    attempts        INTEGER NOT NULL DEFAULT 0,
+    last_error      TEXT NOT NULL DEFAULT '',
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    sent_at         TIMESTAMPTZ,
+    time_stamp      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CONSTRAINT outbox_dedup_key_key UNIQUE (event_type, dedup_key)
+);
+
+CREATE INDEX outbox_pending_idx ON outbox (next_attempt_at) WHERE status = 'pending';
@@ -0,0 +1 @@
+ALTER TABLE account ADD COLUMN is_locked BOOLEAN NOT NULL DEFAULT FALSE;
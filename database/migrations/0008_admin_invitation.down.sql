@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS admin_invitation;
+ALTER TABLE admin DROP COLUMN IF EXISTS permissions;
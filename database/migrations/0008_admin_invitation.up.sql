@@ -0,0 +1,16 @@
+ALTER TABLE admin ADD COLUMN permissions TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE admin_invitation (
+    id          BIGSERIAL PRIMARY KEY,
+    token_hash  TEXT NOT NULL,
+    invited_by  BIGINT NOT NULL REFERENCES account (id),
+    position    TEXT NOT NULL,
+    permissions TEXT NOT NULL DEFAULT '',
+    expires_at  TIMESTAMPTZ NOT NULL,
+    used_at     TIMESTAMPTZ,
+    used_by     BIGINT REFERENCES account (id),
+    time_stamp  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CONSTRAINT admin_invitation_token_hash_key UNIQUE (token_hash)
+);
+
+CREATE INDEX admin_invitation_invited_by_idx ON admin_invitation (invited_by);
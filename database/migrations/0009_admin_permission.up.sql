@@ -0,0 +1,26 @@
+CREATE TABLE admin_role_permission (
+    position   TEXT NOT NULL,
+    permission TEXT NOT NULL,
+    PRIMARY KEY (position, permission)
+);
+
+INSERT INTO admin_role_permission (position, permission) VALUES
+    ('teller', 'user.read'),
+    ('teller', 'user.topup'),
+    ('teller', 'deposit.read'),
+    ('supervisor', 'user.read'),
+    ('supervisor', 'user.topup'),
+    ('supervisor', 'deposit.read'),
+    ('supervisor', 'deposit.manage'),
+    ('auditor', 'user.read'),
+    ('auditor', 'deposit.read'),
+    ('superadmin', 'user.read'),
+    ('superadmin', 'user.topup'),
+    ('superadmin', 'deposit.read'),
+    ('superadmin', 'deposit.manage'),
+    ('superadmin', 'admin.manage');
+
+-- Before permissions every admin could do everything. Admins whose position
+-- is empty or unknown keep that access, so someone can still manage the rest.
+UPDATE admin SET position = 'superadmin'
+WHERE lower(position) NOT IN (SELECT DISTINCT position FROM admin_role_permission);
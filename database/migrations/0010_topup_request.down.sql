@@ -0,0 +1,2 @@
+DELETE FROM admin_role_permission WHERE permission = 'topup.approve';
+DROP TABLE IF EXISTS topup_request;
@@ -0,0 +1,22 @@
+CREATE TABLE topup_request (
+    id                     BIGSERIAL PRIMARY KEY,
+    account_id             BIGINT NOT NULL REFERENCES account (id),
+    amount                 BIGINT NOT NULL CHECK (amount > 0),
+    status                 TEXT NOT NULL DEFAULT 'pending'
+                           CHECK (status IN ('pending', 'approved', 'rejected')),
+    maker_id               BIGINT NOT NULL REFERENCES account (id),
+    maker_reason           TEXT NOT NULL DEFAULT '',
+    checker_id             BIGINT REFERENCES account (id),
+    checker_reason         TEXT NOT NULL DEFAULT '',
+    transaction_history_id BIGINT REFERENCES transaction_history (id),
+    time_stamp             TIMESTAMPTZ NOT NULL DEFAULT now(),
+    decided_at             TIMESTAMPTZ,
+    CONSTRAINT topup_request_checker_not_maker CHECK (checker_id IS NULL OR checker_id <> maker_id)
+);
+
+CREATE INDEX topup_request_status_idx ON topup_request (status, time_stamp);
+CREATE INDEX topup_request_account_id_idx ON topup_request (account_id);
+
+INSERT INTO admin_role_permission (position, permission) VALUES
+    ('supervisor', 'topup.approve'),
+    ('superadmin', 'topup.approve');
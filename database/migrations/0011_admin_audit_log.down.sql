@@ -0,0 +1,3 @@
+DELETE FROM admin_role_permission WHERE permission = 'audit.read';
+DROP TABLE IF EXISTS admin_audit_log;
+DROP FUNCTION IF EXISTS admin_audit_log_append_only();
@@ -0,0 +1,39 @@
+CREATE TABLE admin_audit_log (
+    id                BIGSERIAL PRIMARY KEY,
+    actor_id          BIGINT NOT NULL REFERENCES account (id),
+    action            TEXT NOT NULL,
+    target_account_id BIGINT REFERENCES account (id),
+    request_id        TEXT NOT NULL DEFAULT '',
+    ip                TEXT NOT NULL DEFAULT '',
+    method            TEXT NOT NULL,
+    path              TEXT NOT NULL,
+    status_code       INTEGER NOT NULL,
+    outcome           TEXT NOT NULL CHECK (outcome IN ('success', 'failure', 'denied')),
+    before_state      JSONB,
+    after_state       JSONB,
+    time_stamp        TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX admin_audit_log_actor_id_idx ON admin_audit_log (actor_id, time_stamp);
+CREATE INDEX admin_audit_log_target_account_id_idx ON admin_audit_log (target_account_id, time_stamp);
+CREATE INDEX admin_audit_log_time_stamp_idx ON admin_audit_log (time_stamp);
+CREATE INDEX admin_audit_log_request_id_idx ON admin_audit_log (request_id);
+
+-- The audit trail is append-only: rows can be inserted but never changed.
+CREATE FUNCTION admin_audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'admin_audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER admin_audit_log_no_update_delete
+    BEFORE UPDATE OR DELETE ON admin_audit_log
+    FOR EACH ROW EXECUTE FUNCTION admin_audit_log_append_only();
+
+CREATE TRIGGER admin_audit_log_no_truncate
+    BEFORE TRUNCATE ON admin_audit_log
+    FOR EACH STATEMENT EXECUTE FUNCTION admin_audit_log_append_only();
+
+INSERT INTO admin_role_permission (position, permission) VALUES
+    ('auditor', 'audit.read'),
+    ('superadmin', 'audit.read');
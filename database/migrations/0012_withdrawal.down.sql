@@ -0,0 +1,2 @@
+DELETE FROM admin_role_permission WHERE permission = 'user.withdraw';
+DROP TABLE IF EXISTS withdrawal;
@@ -0,0 +1,25 @@
+CREATE TABLE withdrawal (
+    id                     BIGSERIAL PRIMARY KEY,
+    account_id             BIGINT NOT NULL REFERENCES account (id),
+    amount                 BIGINT NOT NULL CHECK (amount > 0),
+    status                 TEXT NOT NULL DEFAULT 'pending'
+                           CHECK (status IN ('pending', 'completed', 'failed')),
+    channel                TEXT NOT NULL CHECK (channel IN ('user', 'teller')),
+    destination            TEXT NOT NULL DEFAULT '',
+    teller_id              BIGINT REFERENCES account (id),
+    reference              TEXT NOT NULL,
+    transaction_history_id BIGINT NOT NULL REFERENCES transaction_history (id),
+    failure_reason         TEXT NOT NULL DEFAULT '',
+    settled_by             BIGINT REFERENCES account (id),
+    time_stamp             TIMESTAMPTZ NOT NULL DEFAULT now(),
+    settled_at             TIMESTAMPTZ,
+    CONSTRAINT withdrawal_reference_key UNIQUE (reference)
+);
+
+CREATE INDEX withdrawal_account_id_idx ON withdrawal (account_id, time_stamp);
+CREATE INDEX withdrawal_status_idx ON withdrawal (status, time_stamp);
+
+INSERT INTO admin_role_permission (position, permission) VALUES
+    ('teller', 'user.withdraw'),
+    ('supervisor', 'user.withdraw'),
+    ('superadmin', 'user.withdraw');
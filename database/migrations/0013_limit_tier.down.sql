@@ -0,0 +1,4 @@
+DELETE FROM admin_role_permission WHERE permission = 'user.limit';
+DROP INDEX IF EXISTS posting_account_id_limit_idx;
+ALTER TABLE "user" DROP COLUMN IF EXISTS tier;
+DROP TABLE IF EXISTS limit_tier;
@@ -0,0 +1,23 @@
+-- Outgoing limits per customer tier. Zero means no limit.
+CREATE TABLE limit_tier (
+    code           TEXT PRIMARY KEY,
+    name           TEXT NOT NULL,
+    single_max     BIGINT NOT NULL DEFAULT 0 CHECK (single_max >= 0),
+    daily_amount   BIGINT NOT NULL DEFAULT 0 CHECK (daily_amount >= 0),
+    daily_count    BIGINT NOT NULL DEFAULT 0 CHECK (daily_count >= 0),
+    monthly_amount BIGINT NOT NULL DEFAULT 0 CHECK (monthly_amount >= 0),
+    monthly_count  BIGINT NOT NULL DEFAULT 0 CHECK (monthly_count >= 0)
+);
+
+INSERT INTO limit_tier (code, name, single_max, daily_amount, daily_count, monthly_amount, monthly_count) VALUES
+    ('basic', 'Basic', 10000000, 20000000, 10, 100000000, 100),
+    ('silver', 'Silver', 50000000, 100000000, 30, 500000000, 300),
+    ('gold', 'Gold', 250000000, 500000000, 100, 0, 0);
+
+ALTER TABLE "user" ADD COLUMN tier TEXT NOT NULL DEFAULT 'basic' REFERENCES limit_tier (code);
+
+CREATE INDEX posting_account_id_limit_idx ON posting (account_id, journal_entry_id) WHERE amount < 0;
+
+INSERT INTO admin_role_permission (position, permission) VALUES
+    ('supervisor', 'user.limit'),
+    ('superadmin', 'user.limit');
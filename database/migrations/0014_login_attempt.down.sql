@@ -0,0 +1,3 @@
+DELETE FROM admin_role_permission WHERE permission = 'account.unlock';
+DROP TABLE IF EXISTS login_throttle;
+DROP TABLE IF EXISTS login_attempt;
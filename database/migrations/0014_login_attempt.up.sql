@@ -0,0 +1,28 @@
+CREATE TABLE login_attempt (
+    id         BIGSERIAL PRIMARY KEY,
+    username   TEXT NOT NULL,
+    account_id BIGINT REFERENCES account (id) ON DELETE SET NULL,
+    ip         TEXT NOT NULL DEFAULT '',
+    role       INTEGER NOT NULL,
+    success    BOOLEAN NOT NULL,
+    reason     TEXT NOT NULL DEFAULT '',
+    time_stamp TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX login_attempt_username_idx ON login_attempt (username, time_stamp);
+CREATE INDEX login_attempt_ip_idx ON login_attempt (ip, time_stamp);
+CREATE INDEX login_attempt_time_stamp_idx ON login_attempt (time_stamp);
+
+-- Failed-login counters keyed by "user:<username>" or "ip:<address>". Keyed
+-- by username rather than account so unknown usernames lock out the same
+-- way as real ones.
+CREATE TABLE login_throttle (
+    key          TEXT PRIMARY KEY,
+    failures     INTEGER NOT NULL DEFAULT 0,
+    locked_until TIMESTAMPTZ,
+    updated_at   TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+INSERT INTO admin_role_permission (position, permission) VALUES
+    ('supervisor', 'account.unlock'),
+    ('superadmin', 'account.unlock');
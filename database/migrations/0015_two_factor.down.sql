@@ -0,0 +1,4 @@
+ALTER TABLE session DROP COLUMN IF EXISTS two_factor;
+DROP TABLE IF EXISTS login_challenge;
+DROP TABLE IF EXISTS recovery_code;
+DROP TABLE IF EXISTS two_factor;
@@ -0,0 +1,32 @@
+CREATE TABLE two_factor (
+    account_id     BIGINT PRIMARY KEY REFERENCES account (id) ON DELETE CASCADE,
+    secret         TEXT NOT NULL,
+    enabled        BOOLEAN NOT NULL DEFAULT FALSE,
+    last_used_step BIGINT NOT NULL DEFAULT 0,
+    confirmed_at   TIMESTAMPTZ,
+    time_stamp     TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE recovery_code (
+    id         BIGSERIAL PRIMARY KEY,
+    account_id BIGINT NOT NULL REFERENCES account (id) ON DELETE CASCADE,
+    code_hash  TEXT NOT NULL,
+    used_at    TIMESTAMPTZ,
+    time_stamp TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CONSTRAINT recovery_code_code_hash_key UNIQUE (account_id, code_hash)
+);
+
+-- A login that passed the password check and is waiting for the second
+-- factor.
+CREATE TABLE login_challenge (
+    token_hash TEXT PRIMARY KEY,
+    account_id BIGINT NOT NULL REFERENCES account (id) ON DELETE CASCADE,
+    attempts   INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at    TIMESTAMPTZ,
+    time_stamp TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX login_challenge_account_id_idx ON login_challenge (account_id);
+
+ALTER TABLE session ADD COLUMN two_factor BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,2 @@
+DELETE FROM posting WHERE journal_entry_id IN (SELECT id FROM journal_entry WHERE category = 'OpeningBalance');
+DELETE FROM journal_entry WHERE category = 'OpeningBalance';
@@ -0,0 +1,26 @@
+-- Wallet balances from before the ledger existed have no postings behind
+-- them. Post an OpeningBalance entry (cash -> user) for whatever the cached
+-- balance holds beyond the ledger, so ledger.Balance and ledger.Rebuild
+-- agree with user.balance. The cached column is already right and is left
+-- alone.
+DO $$
+DECLARE
+    legacy   RECORD;
+    entry_id BIGINT;
+BEGIN
+    FOR legacy IN
+        SELECT u.account_id, u.balance - COALESCE(SUM(p.amount), 0) AS amount
+        FROM "user" u
+        LEFT JOIN posting p ON p.account_id = u.account_id
+        GROUP BY u.account_id, u.balance
+        HAVING u.balance - COALESCE(SUM(p.amount), 0) <> 0
+    LOOP
+        INSERT INTO journal_entry (category, reference)
+        VALUES ('OpeningBalance', 'opening_balance:' || legacy.account_id)
+        RETURNING id INTO entry_id;
+
+        INSERT INTO posting (journal_entry_id, ledger_account, account_id, amount) VALUES
+            (entry_id, 'user:' || legacy.account_id, legacy.account_id, legacy.amount),
+            (entry_id, 'cash', NULL, -legacy.amount);
+    END LOOP;
+END $$;
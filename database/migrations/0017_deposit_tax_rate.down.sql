@@ -0,0 +1,2 @@
+ALTER TABLE deposit_history DROP COLUMN IF EXISTS tax_rate;
+ALTER TABLE deposit_product DROP COLUMN IF EXISTS tax_rate;
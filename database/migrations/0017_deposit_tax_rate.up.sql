@@ -0,0 +1,6 @@
+-- Final tax withheld on deposito interest, in percent. Zero withholds nothing.
+ALTER TABLE deposit_product ADD COLUMN tax_rate DOUBLE PRECISION NOT NULL DEFAULT 0 CHECK (tax_rate BETWEEN 0 AND 100);
+
+-- The rate in force when a deposito is placed, so later product changes do
+-- not alter the tax on existing depositos.
+ALTER TABLE deposit_history ADD COLUMN tax_rate DOUBLE PRECISION NOT NULL DEFAULT 0 CHECK (tax_rate BETWEEN 0 AND 100);
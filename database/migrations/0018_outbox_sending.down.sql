@@ -0,0 +1,7 @@
+UPDATE outbox SET status = 'pending' WHERE status = 'sending';
+
+DROP INDEX IF EXISTS outbox_pending_idx;
+CREATE INDEX outbox_pending_idx ON outbox (next_attempt_at) WHERE status = 'pending';
+
+ALTER TABLE outbox DROP CONSTRAINT outbox_status_check;
+ALTER TABLE outbox ADD CONSTRAINT outbox_status_check CHECK (status IN ('pending', 'sent', 'failed'));
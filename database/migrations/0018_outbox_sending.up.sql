@@ -0,0 +1,8 @@
+-- A message is marked sending, with next_attempt_at as its lease, while the
+-- relay calls the service outside any transaction. A sending message whose
+-- lease ran out was interrupted mid-call.
+ALTER TABLE outbox DROP CONSTRAINT outbox_status_check;
+ALTER TABLE outbox ADD CONSTRAINT outbox_status_check CHECK (status IN ('pending', 'sending', 'sent', 'failed'));
+
+DROP INDEX outbox_pending_idx;
+CREATE INDEX outbox_pending_idx ON outbox (next_attempt_at) WHERE status IN ('pending', 'sending');
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS transaction_history_maker_id_idx;
+ALTER TABLE transaction_history DROP COLUMN IF EXISTS maker_id;
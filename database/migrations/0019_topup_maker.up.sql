@@ -0,0 +1,5 @@
+-- The admin who credited a direct top-up, so the approval threshold can be
+-- applied to everything one admin tops up for a user within a window.
+ALTER TABLE transaction_history ADD COLUMN maker_id BIGINT REFERENCES account (id);
+
+CREATE INDEX transaction_history_maker_id_idx ON transaction_history (maker_id, account_id, time_stamp) WHERE maker_id IS NOT NULL;
@@ -0,0 +1,56 @@
+// Package deposit books deposito contracts. Service is implemented both by a
+// native engine backed by Postgres and by a client for the external deposit
+// service at SERVER_API, so the rest of the application does not care which
+// one is configured.
+package deposit
+
+import (
+	"context"
+	model "final-project/models"
+	"fmt"
+	"net/http"
+)
+
+type Service interface {
+	Create(ctx context.Context, req Request) (*model.Deposit, error)
+	ListByAccount(ctx context.Context, accountId int64) ([]model.Deposit, error)
+}
+
+// Finder is implemented by services that can tell whether a registration was
+// booked. FindByReference returns nil when no contract has the reference.
+type Finder interface {
+	FindByReference(ctx context.Context, reference string) (*model.Deposit, error)
+}
+
+// Request is the contract registration body, in the wire format of the
+// external deposit service. Reference identifies the registration so a
+// repeated delivery books the contract only once.
+type Request struct {
+	Deposito_Id string `json:"deposito_id"`
+	Account_Id  string `json:"account_id"`
+	Name        string `json:"name"`
+	Amount      int64  `json:"amount"`
+	Min_Month   int    `json:"min_month"`
+	Reference   string `json:"reference,omitempty"`
+}
+
+// APIError is returned when the external deposit service answers with a
+// non-200 status.
+type APIError struct {
+	Status int
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("deposit service responded with status %d", e.Status)
+}
+
+// Rejected reports whether the service definitely refused the request. A
+// timeout, a rate limit or a conflict on the idempotency key says nothing
+// about whether the deposit was booked, so those are not rejections.
+func (e *APIError) Rejected() bool {
+	switch e.Status {
+	case http.StatusRequestTimeout, http.StatusConflict, http.StatusTooManyRequests:
+		return false
+	}
+	return e.Status >= 400 && e.Status < 500
+}
@@ -0,0 +1,70 @@
+package deposit
+
+import (
+	"math"
+	"time"
+)
+
+const daysPerYear = 365
+
+// AccruedInterest is the interest earned by principal after the given number
+// of days at an annual rate in percent, rounded down to a whole unit. Daily
+// accruals are the difference of two running totals, so they always add up to
+// the total at maturity.
+func AccruedInterest(principal int64, rate float64, days int) int64 {
+	return int64(math.Floor(float64(principal) * rate / 100 * float64(days) / daysPerYear))
+}
+
+// WithholdingTax is the tax withheld from an amount of interest when it is
+// paid out or rolled over, at the product's tax rate in percent.
+func WithholdingTax(interest int64, taxRate float64) int64 {
+	return int64(math.Round(float64(interest) * taxRate / 100))
+}
+
+// Day returns the calendar date of t as midnight UTC, which is how accrual
+// dates are stored and compared.
+func Day(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// MaturityDate is the date a deposito started at start with a tenor in months
+// matures.
+func MaturityDate(start time.Time, months int) time.Time {
+	return Day(start).AddDate(0, months, 0)
+}
+
+// DaysBetween counts the calendar days from one date to another.
+func DaysBetween(from, to time.Time) int {
+	return int(Day(to).Sub(Day(from)).Hours() / 24)
+}
+
+type MonthProjection struct {
+	Month        int       `json:"month"`
+	Date         time.Time `json:"date"`
+	Accrued      int64     `json:"accrued_interest"`
+	Tax          int64     `json:"tax"`
+	Net_Interest int64     `json:"net_interest"`
+	Value        int64     `json:"value"`
+}
+
+// Project returns the month-by-month value of a deposito started at start,
+// using the same daily accrual and tax the scheduler applies. The last entry
+// is the value paid at maturity.
+func Project(principal int64, rate, taxRate float64, start time.Time, months int) []MonthProjection {
+	projection := make([]MonthProjection, months)
+	for month := 1; month <= months; month++ {
+		date := MaturityDate(start, month)
+		accrued := AccruedInterest(principal, rate, DaysBetween(start, date))
+		tax := WithholdingTax(accrued, taxRate)
+		projection[month-1] = MonthProjection{
+			Month:        month,
+			Date:         date,
+			Accrued:      accrued,
+			Tax:          tax,
+			Net_Interest: accrued - tax,
+			Value:        principal + accrued - tax,
+		}
+	}
+	return projection
+}
@@ -0,0 +1,150 @@
+package deposit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	model "final-project/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrProductNotFound = errors.New("deposit product not found")
+
+type localService struct {
+	db *gorm.DB
+}
+
+// NewLocal returns the native engine, which keeps contracts in the
+// deposit_contract table.
+func NewLocal(db *gorm.DB) Service {
+	return &localService{
+		db,
+	}
+}
+
+func (s *localService) Create(ctx context.Context, req Request) (*model.Deposit, error) {
+	accountId, err := strconv.ParseInt(req.Account_Id, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Reference != "" {
+		existing := model.DepositContract{}
+		err := s.db.WithContext(ctx).Where("reference = ?", req.Reference).First(&existing).Error
+		if err == nil {
+			deposit := toDeposit(existing, time.Now())
+			return &deposit, nil
+		}
+		if err != gorm.ErrRecordNotFound {
+			return nil, err
+		}
+	}
+
+	product := model.DepositProduct{}
+	if err := s.db.WithContext(ctx).Where("code = ?", req.Deposito_Id).First(&product).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrProductNotFound
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	contract, err := createContract(s.db.WithContext(ctx), accountId, req, product, now)
+	if err != nil {
+		return nil, err
+	}
+
+	deposit := toDeposit(*contract, now)
+	return &deposit, nil
+}
+
+func createContract(tx *gorm.DB, accountId int64, req Request, product model.DepositProduct, start time.Time) (*model.DepositContract, error) {
+	contractId, err := newContractId()
+	if err != nil {
+		return nil, err
+	}
+
+	contract := model.DepositContract{
+		Contract_Id:   contractId,
+		Reference:     req.Reference,
+		Deposit_Id:    req.Deposito_Id,
+		Account_Id:    accountId,
+		Name:          req.Name,
+		Amount:        req.Amount,
+		Tenor_Months:  req.Min_Month,
+		Interest_Rate: product.Interest_Rate,
+		Start_Date:    start,
+		Maturity_Date: MaturityDate(start, req.Min_Month),
+		Status:        model.ContractStatusActive,
+		Time_Stamp:    time.Now(),
+	}
+
+	if err := tx.Create(&contract).Error; err != nil {
+		return nil, err
+	}
+
+	return &contract, nil
+}
+
+func (s *localService) FindByReference(ctx context.Context, reference string) (*model.Deposit, error) {
+	contract := model.DepositContract{}
+	if err := s.db.WithContext(ctx).Where("reference = ?", reference).First(&contract).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	deposit := toDeposit(contract, time.Now())
+	return &deposit, nil
+}
+
+func (s *localService) ListByAccount(ctx context.Context, accountId int64) ([]model.Deposit, error) {
+	var contracts []model.DepositContract
+	if err := s.db.WithContext(ctx).Where("account_id = ?", accountId).Order("start_date DESC").Find(&contracts).Error; err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	deposits := make([]model.Deposit, len(contracts))
+	for i, contract := range contracts {
+		deposits[i] = toDeposit(contract, now)
+	}
+	return deposits, nil
+}
+
+// toDeposit converts a stored contract to the shape the external service
+// returns. An active contract past its maturity date is reported as matured
+// even before the payout job has picked it up.
+func toDeposit(contract model.DepositContract, now time.Time) model.Deposit {
+	status := contract.Status
+	if status == model.ContractStatusActive && !now.Before(contract.Maturity_Date) {
+		status = model.ContractStatusMatured
+	}
+
+	maturity := contract.Maturity_Date
+	return model.Deposit{
+		ContractID:   contract.Contract_Id,
+		DepositoID:   contract.Deposit_Id,
+		Name:         contract.Name,
+		AccountID:    strconv.FormatInt(contract.Account_Id, 10),
+		MinMonth:     contract.Tenor_Months,
+		Amount:       int(contract.Amount),
+		Bonus:        contract.Interest_Rate,
+		MaturityDate: &maturity,
+		Status:       status,
+	}
+}
+
+func newContractId() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "DEP" + strings.ToUpper(hex.EncodeToString(buf)), nil
+}
@@ -0,0 +1,65 @@
+package deposit
+
+import (
+	"errors"
+	"final-project/ledger"
+	model "final-project/models"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrNotReserved = errors.New("deposit is no longer reserved")
+
+// Confirm turns a reservation into a placed deposito once the deposit service
+// has booked the contract.
+func Confirm(tx *gorm.DB, depositHistory *model.DepositHistory, contractId string) error {
+	result := tx.Model(depositHistory).Where("status = ?", model.DepositStatusReserved).Updates(map[string]interface{}{
+		"status":      model.DepositStatusActive,
+		"contract_id": contractId,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotReserved
+	}
+
+	newTransactionHistory := model.TransactionHistory{
+		Account_Id:           depositHistory.Account_Id,
+		Transaction_Category: "Deposito",
+		Amount:               depositHistory.Amount,
+		In_Out:               1,
+		Reference:            contractId,
+		Time_Stamp:           time.Now(),
+	}
+	if err := tx.Create(&newTransactionHistory).Error; err != nil {
+		return err
+	}
+
+	_, err := ledger.Post(tx, "Deposito", fmt.Sprintf("deposit_history:%d", depositHistory.Id),
+		ledger.Internal(ledger.ReserveAccount, -depositHistory.Amount),
+		ledger.Internal(ledger.DepositAccount, depositHistory.Amount),
+	)
+	return err
+}
+
+// Release gives the reserved amount back to the user when the deposit service
+// rejected the deposito. Releasing a deposito that is no longer reserved does
+// nothing.
+func Release(tx *gorm.DB, depositHistory *model.DepositHistory) error {
+	result := tx.Model(depositHistory).Where("status = ?", model.DepositStatusReserved).Update("status", model.DepositStatusReleased)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil
+	}
+
+	_, err := ledger.Post(tx, "DepositoRelease", fmt.Sprintf("deposit_history:%d", depositHistory.Id),
+		ledger.Internal(ledger.ReserveAccount, -depositHistory.Amount),
+		ledger.User(depositHistory.Account_Id, depositHistory.Amount),
+	)
+	return err
+}
@@ -0,0 +1,37 @@
+package deposit
+
+import (
+	"errors"
+	model "final-project/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrProductUnknown      = errors.New("deposit type not recognized")
+	ErrAmountNotAcceptable = errors.New("amount not acceptable")
+	ErrTenorNotAcceptable  = errors.New("tenor not acceptable")
+)
+
+// LookupProduct finds an active product by code and checks the amount and
+// tenor against its limits. Registration and simulation both go through it
+// so they accept exactly the same requests.
+func LookupProduct(db *gorm.DB, code string, amount int64, tenor int) (model.DepositProduct, error) {
+	product := model.DepositProduct{}
+	if err := db.Where("code = ? AND is_active = ?", code, true).First(&product).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return product, ErrProductUnknown
+		}
+		return product, err
+	}
+
+	if !product.AllowsAmount(amount) {
+		return product, ErrAmountNotAcceptable
+	}
+
+	if !product.AllowsTenor(tenor) {
+		return product, ErrTenorNotAcceptable
+	}
+
+	return product, nil
+}
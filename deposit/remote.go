@@ -0,0 +1,86 @@
+package deposit
+
+import (
+	"context"
+	"encoding/json"
+	"final-project/httpclient"
+	model "final-project/models"
+	"net/http"
+	"strconv"
+)
+
+type remoteService struct {
+	baseURL string
+	client  *httpclient.Client
+}
+
+// NewRemote returns a client for the external deposit service.
+func NewRemote(baseURL string, client *httpclient.Client) Service {
+	return &remoteService{
+		baseURL: baseURL,
+		client:  client,
+	}
+}
+
+// Create is not retried here: the reference is passed as Idempotency-Key, but
+// the service is not guaranteed to honour it and offers no lookup by
+// reference, so the outbox relay parks a registration whose outcome is
+// unknown instead of sending it again.
+func (s *remoteService) Create(ctx context.Context, req Request) (*model.Deposit, error) {
+	jsonData, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	header := http.Header{}
+	if req.Reference != "" {
+		header.Set("Idempotency-Key", req.Reference)
+	}
+
+	resp, err := s.client.Do(ctx, http.MethodPost, s.baseURL+"/deposito", header, jsonData, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &APIError{Status: resp.StatusCode}
+	}
+
+	// The service does not promise a body on creation, so fall back to the
+	// request when it does not send the contract back.
+	deposit := model.Deposit{
+		DepositoID: req.Deposito_Id,
+		Name:       req.Name,
+		AccountID:  req.Account_Id,
+		MinMonth:   req.Min_Month,
+		Amount:     int(req.Amount),
+	}
+	var data struct {
+		Data *model.Deposit `json:"data"`
+	}
+	if json.Unmarshal(resp.Body, &data) == nil && data.Data != nil {
+		deposit = *data.Data
+	}
+
+	return &deposit, nil
+}
+
+func (s *remoteService) ListByAccount(ctx context.Context, accountId int64) ([]model.Deposit, error) {
+	resp, err := s.client.Do(ctx, http.MethodGet, s.baseURL+"/deposito/"+strconv.FormatInt(accountId, 10), nil, nil, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &APIError{Status: resp.StatusCode}
+	}
+
+	var data struct {
+		Data []model.Deposit `json:"data"`
+	}
+	if err := json.Unmarshal(resp.Body, &data); err != nil {
+		return nil, err
+	}
+
+	return data.Data, nil
+}
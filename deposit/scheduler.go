@@ -0,0 +1,302 @@
+package deposit
+
+import (
+	"context"
+	"final-project/ledger"
+	model "final-project/models"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Scheduler accrues interest on active depositos once per day and pays out
+// principal plus interest at maturity. Only depositos booked by the built-in
+// engine are handled; the external service matures its own contracts.
+//
+// Every run works from the last stored accrual of each deposito up to the
+// given date, so running it twice for the same date is a no-op and a run after
+// downtime catches up on every missed day.
+type Scheduler struct {
+	db       *gorm.DB
+	interval time.Duration
+}
+
+func NewScheduler(db *gorm.DB, interval time.Duration) *Scheduler {
+	return &Scheduler{
+		db,
+		interval,
+	}
+}
+
+// Start runs the scheduler immediately and then on every interval until ctx
+// is cancelled.
+func (s *Scheduler) Start(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.RunFor(time.Now()); err != nil {
+			log.Printf("deposit scheduler: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunFor accrues and matures every active, locally booked deposito up to and
+// including asOf.
+func (s *Scheduler) RunFor(asOf time.Time) error {
+	var ids []int64
+	if err := s.db.Model(&model.DepositHistory{}).
+		Where("status = ? AND contract_id IN (?)", model.DepositStatusActive, s.db.Model(&model.DepositContract{}).Select("contract_id")).
+		Order("id").Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := s.process(id, Day(asOf)); err != nil {
+			log.Printf("deposit scheduler: deposit_history %d: %v", id, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *Scheduler) process(id int64, asOf time.Time) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var depositHistory model.DepositHistory
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&depositHistory, id).Error; err != nil {
+			return err
+		}
+		if depositHistory.Status != model.DepositStatusActive {
+			return nil
+		}
+
+		if err := accrue(tx, &depositHistory, asOf); err != nil {
+			return err
+		}
+
+		if asOf.Before(MaturityDate(depositHistory.Time_Stamp, depositHistory.Time_Period)) {
+			return nil
+		}
+
+		return mature(tx, &depositHistory)
+	})
+}
+
+// accrue stores one accrual row per missed day up to asOf, capped at the
+// maturity date, and moves the interest into the payable account.
+func accrue(tx *gorm.DB, depositHistory *model.DepositHistory, asOf time.Time) error {
+	start := Day(depositHistory.Time_Stamp)
+	maturity := MaturityDate(depositHistory.Time_Stamp, depositHistory.Time_Period)
+	until := asOf
+	if until.After(maturity) {
+		until = maturity
+	}
+
+	var last model.DepositAccrual
+	next := start.AddDate(0, 0, 1)
+	err := tx.Where("deposit_history_id = ?", depositHistory.Id).Order("accrual_date DESC").First(&last).Error
+	if err == nil {
+		next = Day(last.Accrual_Date).AddDate(0, 0, 1)
+	} else if err != gorm.ErrRecordNotFound {
+		return err
+	}
+
+	var total int64
+	now := time.Now()
+	for day := next; !day.After(until); day = day.AddDate(0, 0, 1) {
+		elapsed := DaysBetween(start, day)
+		amount := AccruedInterest(depositHistory.Amount, depositHistory.Interest_Rate, elapsed) -
+			AccruedInterest(depositHistory.Amount, depositHistory.Interest_Rate, elapsed-1)
+
+		accrual := model.DepositAccrual{
+			Deposit_History_Id: depositHistory.Id,
+			Accrual_Date:       day,
+			Amount:             amount,
+			Time_Stamp:         now,
+		}
+		if err := tx.Create(&accrual).Error; err != nil {
+			return err
+		}
+		total += amount
+	}
+
+	if total == 0 {
+		return nil
+	}
+
+	reference := fmt.Sprintf("deposit_history:%d", depositHistory.Id)
+	_, err = ledger.Post(tx, "DepositoAccrual", reference,
+		ledger.Internal(ledger.InterestAccount, -total),
+		ledger.Internal(ledger.InterestPayableAccount, total),
+	)
+	return err
+}
+
+// mature credits principal plus every accrued day of interest, net of tax, to
+// the user and closes the deposito, or renews it when the user chose a rollover.
+func mature(tx *gorm.DB, depositHistory *model.DepositHistory) error {
+	var interest int64
+	if err := tx.Model(&model.DepositAccrual{}).Where("deposit_history_id = ?", depositHistory.Id).Select("COALESCE(SUM(amount), 0)").Scan(&interest).Error; err != nil {
+		return err
+	}
+
+	// Tax is withheld once, on everything accrued, at the rate locked when
+	// the deposito was placed, before the interest is paid out or rolled
+	// over.
+	if tax := WithholdingTax(interest, depositHistory.Tax_Rate); tax > 0 {
+		reference := fmt.Sprintf("deposit_history:%d", depositHistory.Id)
+		if _, err := ledger.Post(tx, "DepositoTax", reference,
+			ledger.Internal(ledger.InterestPayableAccount, -tax),
+			ledger.Internal(ledger.TaxPayableAccount, tax),
+		); err != nil {
+			return err
+		}
+		interest -= tax
+	}
+
+	renewed := false
+	if depositHistory.Rollover == model.RolloverPrincipal || depositHistory.Rollover == model.RolloverPrincipalInterest {
+		var err error
+		if renewed, err = rollover(tx, depositHistory, interest); err != nil {
+			return err
+		}
+	}
+
+	if !renewed {
+		if err := payout(tx, depositHistory, interest); err != nil {
+			return err
+		}
+	}
+
+	if depositHistory.Contract_Id != "" {
+		if err := tx.Model(&model.DepositContract{}).Where("contract_id = ?", depositHistory.Contract_Id).Update("status", model.ContractStatusMatured).Error; err != nil {
+			return err
+		}
+	}
+
+	return tx.Model(depositHistory).Update("status", model.DepositStatusMatured).Error
+}
+
+func payout(tx *gorm.DB, depositHistory *model.DepositHistory, interest int64) error {
+	now := time.Now()
+	histories := []model.TransactionHistory{
+		{
+			Account_Id:           depositHistory.Account_Id,
+			Transaction_Category: "DepositoMaturity",
+			Amount:               depositHistory.Amount,
+			In_Out:               0,
+			Reference:            depositHistory.Contract_Id,
+			Time_Stamp:           now,
+		},
+	}
+	postings := []ledger.Posting{
+		ledger.Internal(ledger.DepositAccount, -depositHistory.Amount),
+		ledger.User(depositHistory.Account_Id, depositHistory.Amount+interest),
+	}
+	if interest > 0 {
+		histories = append(histories, interestHistory(depositHistory, interest, now))
+		postings = append(postings, ledger.Internal(ledger.InterestPayableAccount, -interest))
+	}
+
+	if err := tx.Create(&histories).Error; err != nil {
+		return err
+	}
+
+	reference := fmt.Sprintf("deposit_history:%d", depositHistory.Id)
+	_, err := ledger.Post(tx, "DepositoMaturity", reference, postings...)
+	return err
+}
+
+// rollover opens a new deposito for the same product and tenor, starting on
+// the maturity date at the product's current rate. The principal stays in the
+// deposit account; the interest is either paid out or added to the new
+// principal. It reports false without doing anything when the product has
+// been retired, in which case the deposito is paid out instead.
+func rollover(tx *gorm.DB, depositHistory *model.DepositHistory, interest int64) (bool, error) {
+	var product model.DepositProduct
+	if err := tx.Where("code = ? AND is_active = ?", depositHistory.Deposit_Id, true).First(&product).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+
+	amount := depositHistory.Amount
+	if depositHistory.Rollover == model.RolloverPrincipalInterest {
+		amount += interest
+	}
+
+	start := MaturityDate(depositHistory.Time_Stamp, depositHistory.Time_Period)
+	renewed := model.DepositHistory{
+		Deposit_Id:     depositHistory.Deposit_Id,
+		Account_Id:     depositHistory.Account_Id,
+		Deposit_Name:   depositHistory.Deposit_Name,
+		Amount:         amount,
+		Time_Period:    depositHistory.Time_Period,
+		Interest_Rate:  product.Interest_Rate,
+		Tax_Rate:       product.Tax_Rate,
+		Rollover:       depositHistory.Rollover,
+		Rolled_From_Id: &depositHistory.Id,
+		Status:         model.DepositStatusActive,
+		Time_Stamp:     start,
+	}
+
+	contract, err := createContract(tx, depositHistory.Account_Id, Request{
+		Deposito_Id: depositHistory.Deposit_Id,
+		Name:        depositHistory.Deposit_Name,
+		Amount:      amount,
+		Min_Month:   depositHistory.Time_Period,
+	}, product, start)
+	if err != nil {
+		return false, err
+	}
+	renewed.Contract_Id = contract.Contract_Id
+
+	if err := tx.Create(&renewed).Error; err != nil {
+		return false, err
+	}
+
+	if interest == 0 {
+		return true, nil
+	}
+
+	reference := fmt.Sprintf("deposit_history:%d", depositHistory.Id)
+	if depositHistory.Rollover == model.RolloverPrincipalInterest {
+		_, err := ledger.Post(tx, "DepositoRollover", reference,
+			ledger.Internal(ledger.InterestPayableAccount, -interest),
+			ledger.Internal(ledger.DepositAccount, interest),
+		)
+		return true, err
+	}
+
+	history := interestHistory(depositHistory, interest, time.Now())
+	if err := tx.Create(&history).Error; err != nil {
+		return false, err
+	}
+
+	_, err = ledger.Post(tx, "DepositoRollover", reference,
+		ledger.Internal(ledger.InterestPayableAccount, -interest),
+		ledger.User(depositHistory.Account_Id, interest),
+	)
+	return true, err
+}
+
+func interestHistory(depositHistory *model.DepositHistory, interest int64, now time.Time) model.TransactionHistory {
+	return model.TransactionHistory{
+		Account_Id:           depositHistory.Account_Id,
+		Transaction_Category: "DepositoInterest",
+		Amount:               interest,
+		In_Out:               0,
+		Reference:            depositHistory.Contract_Id,
+		Time_Stamp:           now,
+	}
+}
@@ -0,0 +1,134 @@
+package deposit
+
+import (
+	"errors"
+	"final-project/ledger"
+	model "final-project/models"
+	"fmt"
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrNotActive = errors.New("deposit is not active")
+	ErrMatured   = errors.New("deposit has reached maturity")
+)
+
+type WithdrawalQuote struct {
+	Principal      int64 `json:"principal"`
+	Interest       int64 `json:"interest"`
+	Tax            int64 `json:"tax"`
+	Penalty        int64 `json:"penalty"`
+	Net            int64 `json:"net"`
+	Months_Elapsed int   `json:"months_elapsed"`
+}
+
+// MonthsElapsed counts the whole months between start and now.
+func MonthsElapsed(start, now time.Time) int {
+	months := 0
+	for !Day(start).AddDate(0, months+1, 0).After(Day(now)) {
+		months++
+	}
+	return months
+}
+
+// EarlyWithdrawalPenalty charges the product's penalty rate (percent of the
+// principal) in proportion to the part of the tenor that is left, so breaking
+// a deposito near maturity costs less than breaking it right away.
+func EarlyWithdrawalPenalty(principal int64, penaltyRate float64, tenor, elapsed int) int64 {
+	if tenor <= 0 || elapsed >= tenor {
+		return 0
+	}
+	remaining := float64(tenor-elapsed) / float64(tenor)
+	return int64(math.Ceil(float64(principal) * penaltyRate / 100 * remaining))
+}
+
+// QuoteWithdrawal prices breaking the deposito at now: principal plus the
+// interest accrued so far, minus tax and the penalty.
+func QuoteWithdrawal(depositHistory model.DepositHistory, product model.DepositProduct, now time.Time) (WithdrawalQuote, error) {
+	if depositHistory.Status != model.DepositStatusActive {
+		return WithdrawalQuote{}, ErrNotActive
+	}
+	if !Day(now).Before(MaturityDate(depositHistory.Time_Stamp, depositHistory.Time_Period)) {
+		return WithdrawalQuote{}, ErrMatured
+	}
+
+	elapsed := MonthsElapsed(depositHistory.Time_Stamp, now)
+	quote := WithdrawalQuote{
+		Principal:      depositHistory.Amount,
+		Interest:       AccruedInterest(depositHistory.Amount, depositHistory.Interest_Rate, DaysBetween(depositHistory.Time_Stamp, now)),
+		Penalty:        EarlyWithdrawalPenalty(depositHistory.Amount, product.Early_Withdrawal_Penalty, depositHistory.Time_Period, elapsed),
+		Months_Elapsed: elapsed,
+	}
+	quote.Tax = WithholdingTax(quote.Interest, depositHistory.Tax_Rate)
+	if quote.Penalty > quote.Principal+quote.Interest-quote.Tax {
+		quote.Penalty = quote.Principal + quote.Interest - quote.Tax
+	}
+	quote.Net = quote.Principal + quote.Interest - quote.Tax - quote.Penalty
+
+	return quote, nil
+}
+
+// Withdraw breaks the deposito inside tx. The caller must hold a row lock on
+// depositHistory. Interest is accrued up to now first so the amount paid
+// matches the quote.
+func Withdraw(tx *gorm.DB, depositHistory *model.DepositHistory, product model.DepositProduct, now time.Time) (WithdrawalQuote, error) {
+	quote, err := QuoteWithdrawal(*depositHistory, product, now)
+	if err != nil {
+		return quote, err
+	}
+
+	if err := accrue(tx, depositHistory, Day(now)); err != nil {
+		return quote, err
+	}
+
+	histories := []model.TransactionHistory{}
+	if quote.Net > 0 {
+		histories = append(histories, model.TransactionHistory{
+			Account_Id:           depositHistory.Account_Id,
+			Transaction_Category: "DepositoWithdrawal",
+			Amount:               quote.Net,
+			In_Out:               0,
+			Reference:            depositHistory.Contract_Id,
+			Time_Stamp:           now,
+		})
+		if err := tx.Create(&histories).Error; err != nil {
+			return quote, err
+		}
+	}
+
+	postings := []ledger.Posting{
+		ledger.Internal(ledger.DepositAccount, -quote.Principal),
+	}
+	if quote.Interest > 0 {
+		postings = append(postings, ledger.Internal(ledger.InterestPayableAccount, -quote.Interest))
+	}
+	if quote.Net > 0 {
+		postings = append(postings, ledger.User(depositHistory.Account_Id, quote.Net))
+	}
+	if quote.Tax > 0 {
+		postings = append(postings, ledger.Internal(ledger.TaxPayableAccount, quote.Tax))
+	}
+	if quote.Penalty > 0 {
+		postings = append(postings, ledger.Internal(ledger.PenaltyAccount, quote.Penalty))
+	}
+
+	reference := fmt.Sprintf("deposit_history:%d", depositHistory.Id)
+	if _, err := ledger.Post(tx, "DepositoWithdrawal", reference, postings...); err != nil {
+		return quote, err
+	}
+
+	if depositHistory.Contract_Id != "" {
+		if err := tx.Model(&model.DepositContract{}).Where("contract_id = ?", depositHistory.Contract_Id).Update("status", model.ContractStatusClosed).Error; err != nil {
+			return quote, err
+		}
+	}
+
+	if err := tx.Model(depositHistory).Update("status", model.DepositStatusClosed).Error; err != nil {
+		return quote, err
+	}
+
+	return quote, nil
+}
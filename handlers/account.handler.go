@@ -1,22 +1,39 @@
 package handlers
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"final-project/loginguard"
 	model "final-project/models"
+	"final-project/totp"
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type AccountInterface interface {
 	AccountUserLogin(*gin.Context)
 	AccountAdminLogin(*gin.Context)
 	AccountUserSignup(*gin.Context)
-	AccountAdminSignup(*gin.Context)
+	AcceptAdminInvitation(*gin.Context)
+	LoginTwoFactor(*gin.Context)
+	EnrollTwoFactor(*gin.Context)
+	ConfirmTwoFactor(*gin.Context)
+	DisableTwoFactor(*gin.Context)
+	RegenerateRecoveryCodes(*gin.Context)
 	ChangePassword(*gin.Context)
+	RefreshToken(*gin.Context)
+	Logout(*gin.Context)
 }
 
 type accountImplement struct {
@@ -24,6 +41,11 @@ type accountImplement struct {
 	jwtKey []byte
 }
 
+const (
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 7 * 24 * time.Hour
+)
+
 func NewAccount(db *gorm.DB, jwtKey []byte) AccountInterface {
 	return &accountImplement{
 		db,
@@ -37,6 +59,24 @@ type LoginPayload struct {
 }
 
 func (a *accountImplement) AccountAdminLogin(ctx *gin.Context) {
+	a.login(ctx, model.RoleAdmin)
+}
+
+func (a *accountImplement) AccountUserLogin(ctx *gin.Context) {
+	a.login(ctx, model.RoleUser)
+}
+
+// dummyPasswordHash is compared against when the username does not exist so
+// unknown and known usernames take the same time to reject.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+
+const errInvalidCredentials = "invalid username or password"
+
+// login checks the credentials of an account with the given role. Unknown
+// usernames and wrong passwords get the same answer, repeated failures lock
+// the username and the client IP out for a while, and every attempt is
+// written to login_attempt.
+func (a *accountImplement) login(ctx *gin.Context, role int) {
 	payload := LoginPayload{}
 
 	if err := ctx.ShouldBindJSON(&payload); err != nil {
@@ -46,77 +86,113 @@ func (a *accountImplement) AccountAdminLogin(ctx *gin.Context) {
 		return
 	}
 
-	account := model.Account{}
-	if err := a.db.Where("username = ? AND role = ?", payload.Username, 1).First(&account).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
-				"error": "username not found",
-			})
-			return
+	ip := ctx.ClientIP()
+	attempt := model.LoginAttempt{
+		Username: payload.Username,
+		Ip:       ip,
+		Role:     role,
+	}
+	record := func(success bool, reason string) {
+		attempt.Success = success
+		attempt.Reason = reason
+		if err := loginguard.Record(a.db, attempt); err != nil {
+			log.Printf("login attempt: %v", err)
 		}
-		return
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(account.Password), []byte(payload.Password)); err != nil {
-		ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{
-			"error": "wrong password",
+	// The attempt is counted before the password is checked, so a burst of
+	// parallel guesses cannot all get past the threshold.
+	wait, err := loginguard.Attempt(a.db, payload.Username, ip)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
 		})
 		return
 	}
-
-	token, err := a.createJWT(&account)
-	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
-			"error": err,
+	if wait > 0 {
+		record(false, loginguard.ReasonThrottled)
+		ctx.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		ctx.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+			"error": "too many failed attempts, try again later",
 		})
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{
-		"message": "success",
-		"token":   token,
-	})
-}
+	account := model.Account{}
+	found := true
+	if err := a.db.Where("username = ? AND role = ?", payload.Username, role).First(&account).Error; err != nil {
+		if err != gorm.ErrRecordNotFound {
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		found = false
+		account.Password = string(dummyPasswordHash)
+	} else {
+		attempt.Account_Id = &account.Id
+	}
 
-func (a *accountImplement) AccountUserLogin(ctx *gin.Context) {
-	payload := LoginPayload{}
+	if err := bcrypt.CompareHashAndPassword([]byte(account.Password), []byte(payload.Password)); err != nil || !found {
+		reason := loginguard.ReasonWrongPassword
+		if !found {
+			reason = loginguard.ReasonUnknownUser
+		}
+		record(false, reason)
 
-	if err := ctx.ShouldBindJSON(&payload); err != nil {
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
-			"error": err.Error(),
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": errInvalidCredentials,
 		})
 		return
 	}
 
-	account := model.Account{}
-	if err := a.db.Where("username = ? AND role = ?", payload.Username, 0).First(&account).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
-				"error": "username not found",
+	if account.Is_Locked {
+		record(false, loginguard.ReasonLocked)
+		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": "account locked",
+		})
+		return
+	}
+
+	var twoFactor model.TwoFactor
+	if err := a.db.Where("account_id = ? AND enabled", account.Id).First(&twoFactor).Error; err == nil {
+		challenge, err := a.createChallenge(account.Id)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
 			})
 			return
 		}
-		return
-	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(account.Password), []byte(payload.Password)); err != nil {
-		ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{
-			"error": "wrong password",
+		// The username counter is only cleared once the second factor is
+		// verified, so a leaked password does not allow unlimited guesses
+		// at the code.
+		record(false, loginguard.ReasonTwoFactorPending)
+		ctx.JSON(http.StatusOK, gin.H{
+			"message":             "two-factor code required",
+			"two_factor_required": true,
+			"challenge":           challenge,
 		})
 		return
 	}
 
-	token, err := a.createJWT(&account)
+	token, refreshToken, err := a.createSession(&account, false)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
-			"error": err,
+			"error": err.Error(),
 		})
 		return
 	}
 
+	record(true, loginguard.ReasonSuccess)
+	if err := loginguard.Success(a.db, payload.Username, ip); err != nil {
+		log.Printf("login throttle: %v", err)
+	}
+
 	ctx.JSON(http.StatusOK, gin.H{
-		"message": "success",
-		"token":   token,
+		"message":       "success",
+		"token":         token,
+		"refresh_token": refreshToken,
 	})
 }
 
@@ -126,8 +202,18 @@ type SignUpPayload struct {
 	Name     string `json:"name"`
 }
 
-func (a *accountImplement) AccountAdminSignup(ctx *gin.Context) {
-	payload := SignUpPayload{}
+type AdminSignUpPayload struct {
+	Token    string `json:"token" binding:"required"`
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+	Name     string `json:"name" binding:"required"`
+}
+
+// AcceptAdminInvitation creates an admin account from a single-use invitation
+// issued by an existing admin. The position and permissions come from the
+// invitation, not from the request.
+func (a *accountImplement) AcceptAdminInvitation(ctx *gin.Context) {
+	payload := AdminSignUpPayload{}
 
 	if err := ctx.ShouldBindJSON(&payload); err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
@@ -137,7 +223,7 @@ func (a *accountImplement) AccountAdminSignup(ctx *gin.Context) {
 	}
 
 	existingUser := model.Account{}
-	if result := a.db.Where("username = ? AND role = ?", payload.Username, 1).First(&existingUser); result.RowsAffected > 0 {
+	if result := a.db.Where("username = ?", payload.Username).First(&existingUser); result.RowsAffected > 0 {
 		ctx.AbortWithStatusJSON(http.StatusConflict, gin.H{
 			"error": "username already exist",
 		})
@@ -147,14 +233,9 @@ func (a *accountImplement) AccountAdminSignup(ctx *gin.Context) {
 	hashPassword, err := bcrypt.GenerateFromPassword([]byte(payload.Password), bcrypt.DefaultCost)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
-			"error": err,
+			"error": err.Error(),
 		})
-	}
-
-	newAccount := model.Account{
-		Username: payload.Username,
-		Password: string(hashPassword),
-		Role:     1,
+		return
 	}
 
 	tx := a.db.Begin()
@@ -164,6 +245,21 @@ func (a *accountImplement) AccountAdminSignup(ctx *gin.Context) {
 		}
 	}()
 
+	invitation := model.AdminInvitation{}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("token_hash = ?", hashToken(payload.Token)).First(&invitation).Error; err != nil || invitation.Used_At != nil || time.Now().After(invitation.Expires_At) {
+		tx.Rollback()
+		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": "invalid or expired invitation",
+		})
+		return
+	}
+
+	newAccount := model.Account{
+		Username: payload.Username,
+		Password: string(hashPassword),
+		Role:     model.RoleAdmin,
+	}
+
 	if err := tx.Create(&newAccount).Error; err != nil {
 		tx.Rollback()
 		ctx.JSON(http.StatusInternalServerError, gin.H{
@@ -173,8 +269,10 @@ func (a *accountImplement) AccountAdminSignup(ctx *gin.Context) {
 	}
 
 	newAdmin := model.Admin{
-		Account_Id: newAccount.Id,
-		Name:       payload.Name,
+		Account_Id:  newAccount.Id,
+		Name:        payload.Name,
+		Position:    invitation.Position,
+		Permissions: invitation.Permissions,
 	}
 
 	if err := tx.Create(&newAdmin).Error; err != nil {
@@ -185,6 +283,17 @@ func (a *accountImplement) AccountAdminSignup(ctx *gin.Context) {
 		return
 	}
 
+	if err := tx.Model(&invitation).Updates(map[string]interface{}{
+		"used_at": time.Now(),
+		"used_by": newAccount.Id,
+	}).Error; err != nil {
+		tx.Rollback()
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
 	if err := tx.Commit().Error; err != nil {
 		tx.Rollback()
 		ctx.JSON(http.StatusInternalServerError, gin.H{
@@ -209,7 +318,7 @@ func (a *accountImplement) AccountUserSignup(ctx *gin.Context) {
 	}
 
 	existingUser := model.Account{}
-	if result := a.db.Where("username = ? AND role = ?", payload.Username, 0).First(&existingUser); result.RowsAffected > 0 {
+	if result := a.db.Where("username = ?", payload.Username).First(&existingUser); result.RowsAffected > 0 {
 		ctx.AbortWithStatusJSON(http.StatusConflict, gin.H{
 			"error": "username already exist",
 		})
@@ -226,7 +335,7 @@ func (a *accountImplement) AccountUserSignup(ctx *gin.Context) {
 	newAccount := model.Account{
 		Username: payload.Username,
 		Password: string(hashPassword),
-		Role:     0,
+		Role:     model.RoleUser,
 	}
 
 	tx := a.db.Begin()
@@ -295,7 +404,7 @@ func (a *accountImplement) ChangePassword(ctx *gin.Context) {
 
 	id := ctx.GetInt64("id")
 	var account model.Account
-	if err := a.db.Where("role = ?", 0).First(&account, id).Error; err != nil {
+	if err := a.db.Where("role = ?", model.RoleUser).First(&account, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{
 				"error": "account not found",
@@ -329,13 +438,222 @@ func (a *accountImplement) ChangePassword(ctx *gin.Context) {
 	})
 }
 
-func (a *accountImplement) createJWT(account *model.Account) (string, error) {
+type RefreshPayload struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// RefreshToken exchanges a refresh token for a new access token and rotates
+// the refresh token. Presenting a refresh token that was already used revokes
+// the whole session, since it means the token has leaked.
+func (a *accountImplement) RefreshToken(ctx *gin.Context) {
+	payload := RefreshPayload{}
+	if err := ctx.ShouldBindJSON(&payload); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	tx := a.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	stored := model.RefreshToken{}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("token_hash = ?", hashToken(payload.RefreshToken)).First(&stored).Error; err != nil {
+		tx.Rollback()
+		if err == gorm.ErrRecordNotFound {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "invalid refresh token",
+			})
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	session := model.Session{}
+	if err := tx.Where("id = ?", stored.Session_Id).First(&session).Error; err != nil {
+		tx.Rollback()
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "invalid refresh token",
+		})
+		return
+	}
+
+	now := time.Now()
+	if session.Revoked_At != nil || now.After(stored.Expires_At) {
+		tx.Rollback()
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "invalid refresh token",
+		})
+		return
+	}
+
+	if stored.Used_At != nil {
+		if err := tx.Model(&session).Update("revoked_at", now).Error; err != nil {
+			tx.Rollback()
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		if err := tx.Commit().Error; err != nil {
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "refresh token reuse detected, session revoked",
+		})
+		return
+	}
+
+	if err := tx.Model(&stored).Update("used_at", now).Error; err != nil {
+		tx.Rollback()
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	refreshToken, err := a.createRefreshToken(tx, &session)
+	if err != nil {
+		tx.Rollback()
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	account := model.Account{}
+	if err := tx.First(&account, session.Account_Id).Error; err != nil || account.Is_Locked {
+		tx.Rollback()
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "invalid refresh token",
+		})
+		return
+	}
+
+	token, err := a.createJWT(&account, session.Id)
+	if err != nil {
+		tx.Rollback()
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message":       "success",
+		"token":         token,
+		"refresh_token": refreshToken,
+	})
+}
+
+// Logout revokes the session of the calling token, which invalidates both
+// its access token and every refresh token issued for it.
+func (a *accountImplement) Logout(ctx *gin.Context) {
+	sessionId := ctx.GetString("session_id")
+
+	if err := a.db.Model(&model.Session{}).Where("id = ? AND revoked_at IS NULL", sessionId).Update("revoked_at", time.Now()).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "success",
+	})
+}
+
+// createSession opens a new server-side session for the account and returns
+// its first access and refresh token pair.
+func (a *accountImplement) createSession(account *model.Account, twoFactor bool) (string, string, error) {
+	sessionId, err := randomToken(16)
+	if err != nil {
+		return "", "", err
+	}
+
+	now := time.Now()
+	session := model.Session{
+		Id:         sessionId,
+		Account_Id: account.Id,
+		Expires_At: now.Add(refreshTokenTTL),
+		Two_Factor: twoFactor,
+		Time_Stamp: now,
+	}
+
+	var token, refreshToken string
+	err = a.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&session).Error; err != nil {
+			return err
+		}
+
+		refreshToken, err = a.createRefreshToken(tx, &session)
+		if err != nil {
+			return err
+		}
+
+		token, err = a.createJWT(account, session.Id)
+		return err
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	return token, refreshToken, nil
+}
+
+// createRefreshToken stores the hash of a fresh refresh token for the session
+// and extends the session to the new token's expiry.
+func (a *accountImplement) createRefreshToken(tx *gorm.DB, session *model.Session) (string, error) {
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	stored := model.RefreshToken{
+		Session_Id: session.Id,
+		Token_Hash: hashToken(refreshToken),
+		Expires_At: now.Add(refreshTokenTTL),
+		Time_Stamp: now,
+	}
+
+	if err := tx.Create(&stored).Error; err != nil {
+		return "", err
+	}
+
+	if err := tx.Model(session).Update("expires_at", stored.Expires_At).Error; err != nil {
+		return "", err
+	}
+
+	return refreshToken, nil
+}
+
+func (a *accountImplement) createJWT(account *model.Account, sessionId string) (string, error) {
 	token := jwt.New(jwt.SigningMethodHS256)
 
 	claims := token.Claims.(jwt.MapClaims)
 	claims["id"] = account.Id
 	claims["username"] = account.Username
-	claims["exp"] = time.Now().Add(time.Hour * 6).Unix()
+	claims["role"] = account.Role
+	claims["sid"] = sessionId
+	claims["exp"] = time.Now().Add(accessTokenTTL).Unix()
 
 	tokenString, err := token.SignedString(a.jwtKey)
 	if err != nil {
@@ -344,3 +662,514 @@ func (a *accountImplement) createJWT(account *model.Account) (string, error) {
 
 	return tokenString, nil
 }
+
+func randomToken(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+const (
+	totpIssuer        = "Deposito"
+	challengeTTL      = 5 * time.Minute
+	challengeAttempts = 5
+	recoveryCodeCount = 10
+)
+
+var errInvalidSecondFactor = errors.New("invalid two-factor code")
+
+// createChallenge stores the hash of a short-lived token that lets the
+// caller finish a login with their second factor.
+func (a *accountImplement) createChallenge(accountId int64) (string, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	challenge := model.LoginChallenge{
+		Token_Hash: hashToken(token),
+		Account_Id: accountId,
+		Expires_At: now.Add(challengeTTL),
+		Time_Stamp: now,
+	}
+	if err := a.db.Create(&challenge).Error; err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+type TwoFactorCodePayload struct {
+	Code          string `json:"code"`
+	Recovery_Code string `json:"recovery_code"`
+}
+
+type LoginTwoFactorPayload struct {
+	Challenge string `json:"challenge" binding:"required"`
+	TwoFactorCodePayload
+}
+
+// LoginTwoFactor finishes a login started by AccountUserLogin or
+// AccountAdminLogin by checking a TOTP or recovery code against the
+// challenge they returned.
+func (a *accountImplement) LoginTwoFactor(ctx *gin.Context) {
+	payload := LoginTwoFactorPayload{}
+	if err := ctx.ShouldBindJSON(&payload); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	tx := a.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	challenge := model.LoginChallenge{}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("token_hash = ?", hashToken(payload.Challenge)).First(&challenge).Error; err != nil ||
+		challenge.Used_At != nil || challenge.Attempts >= challengeAttempts || time.Now().After(challenge.Expires_At) {
+		tx.Rollback()
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "invalid or expired challenge",
+		})
+		return
+	}
+
+	account := model.Account{}
+	if err := tx.First(&account, challenge.Account_Id).Error; err != nil {
+		tx.Rollback()
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ip := ctx.ClientIP()
+	attempt := model.LoginAttempt{
+		Username:   account.Username,
+		Account_Id: &account.Id,
+		Ip:         ip,
+		Role:       account.Role,
+	}
+
+	if wait, err := loginguard.Lockout(tx, account.Username, ip); err != nil || wait > 0 {
+		tx.Rollback()
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		attempt.Reason = loginguard.ReasonThrottled
+		if err := loginguard.Record(a.db, attempt); err != nil {
+			log.Printf("login attempt: %v", err)
+		}
+		ctx.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		ctx.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+			"error": "too many failed attempts, try again later",
+		})
+		return
+	}
+
+	if err := verifySecondFactor(tx, account.Id, payload.TwoFactorCodePayload); err != nil {
+		if err != errInvalidSecondFactor {
+			tx.Rollback()
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		if err := tx.Model(&challenge).Update("attempts", gorm.Expr("attempts + 1")).Error; err != nil {
+			tx.Rollback()
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		if err := tx.Commit().Error; err != nil {
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		attempt.Reason = loginguard.ReasonWrongCode
+		if err := loginguard.Record(a.db, attempt); err != nil {
+			log.Printf("login attempt: %v", err)
+		}
+		if err := loginguard.Failure(a.db, account.Username, ip); err != nil {
+			log.Printf("login throttle: %v", err)
+		}
+
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err := tx.Model(&challenge).Update("used_at", time.Now()).Error; err != nil {
+		tx.Rollback()
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if account.Is_Locked {
+		attempt.Reason = loginguard.ReasonLocked
+		if err := loginguard.Record(a.db, attempt); err != nil {
+			log.Printf("login attempt: %v", err)
+		}
+		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": "account locked",
+		})
+		return
+	}
+
+	token, refreshToken, err := a.createSession(&account, true)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	attempt.Success = true
+	attempt.Reason = loginguard.ReasonSuccess
+	if err := loginguard.Record(a.db, attempt); err != nil {
+		log.Printf("login attempt: %v", err)
+	}
+	if err := loginguard.Success(a.db, account.Username, ip); err != nil {
+		log.Printf("login throttle: %v", err)
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message":       "success",
+		"token":         token,
+		"refresh_token": refreshToken,
+	})
+}
+
+// verifySecondFactor accepts either a TOTP code or an unused recovery code
+// and burns it so it cannot be replayed.
+func verifySecondFactor(tx *gorm.DB, accountId int64, payload TwoFactorCodePayload) error {
+	// An enrollment that was never confirmed is not a second factor yet.
+	twoFactor := model.TwoFactor{}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("account_id = ? AND enabled", accountId).First(&twoFactor).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return errInvalidSecondFactor
+		}
+		return err
+	}
+
+	if payload.Recovery_Code != "" {
+		result := tx.Model(&model.RecoveryCode{}).
+			Where("account_id = ? AND code_hash = ? AND used_at IS NULL", accountId, hashToken(normalizeRecoveryCode(payload.Recovery_Code))).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errInvalidSecondFactor
+		}
+		return nil
+	}
+
+	step, ok := totp.Validate(twoFactor.Secret, payload.Code, time.Now(), twoFactor.Last_Used_Step)
+	if !ok {
+		return errInvalidSecondFactor
+	}
+	return tx.Model(&twoFactor).Update("last_used_step", step).Error
+}
+
+// EnrollTwoFactor starts TOTP enrollment with a fresh secret. Nothing is
+// enforced until the first code is confirmed.
+func (a *accountImplement) EnrollTwoFactor(ctx *gin.Context) {
+	id := ctx.GetInt64("id")
+
+	existing := model.TwoFactor{}
+	if err := a.db.Where("account_id = ?", id).First(&existing).Error; err == nil && existing.Enabled {
+		ctx.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error": "two-factor authentication is already enabled",
+		})
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	twoFactor := model.TwoFactor{
+		Account_Id: id,
+		Secret:     secret,
+		Time_Stamp: time.Now(),
+	}
+	if err := a.db.Save(&twoFactor).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message":          "success",
+		"secret":           secret,
+		"provisioning_uri": totp.ProvisioningURI(totpIssuer, ctx.GetString("username"), secret),
+	})
+}
+
+type ConfirmTwoFactorPayload struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// ConfirmTwoFactor turns 2FA on with the first code from the authenticator
+// and returns the recovery codes. The current session counts as verified.
+// Wrong codes are throttled per account like failed logins.
+func (a *accountImplement) ConfirmTwoFactor(ctx *gin.Context) {
+	id := ctx.GetInt64("id")
+	payload := ConfirmTwoFactorPayload{}
+	if err := ctx.ShouldBindJSON(&payload); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	key := loginguard.EnrollKey(id)
+	wait, err := loginguard.AttemptKey(a.db, key, loginguard.AccountPolicy)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if wait > 0 {
+		ctx.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		ctx.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+			"error": "too many failed attempts, try again later",
+		})
+		return
+	}
+
+	var codes []string
+	err = a.db.Transaction(func(tx *gorm.DB) error {
+		twoFactor := model.TwoFactor{}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("account_id = ? AND NOT enabled", id).First(&twoFactor).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return errInvalidSecondFactor
+			}
+			return err
+		}
+
+		step, ok := totp.Validate(twoFactor.Secret, payload.Code, time.Now(), twoFactor.Last_Used_Step)
+		if !ok {
+			return errInvalidSecondFactor
+		}
+
+		if err := tx.Model(&twoFactor).Updates(map[string]interface{}{
+			"enabled":        true,
+			"last_used_step": step,
+			"confirmed_at":   time.Now(),
+		}).Error; err != nil {
+			return err
+		}
+
+		var err error
+		if codes, err = replaceRecoveryCodes(tx, id); err != nil {
+			return err
+		}
+
+		return tx.Model(&model.Session{}).Where("id = ?", ctx.GetString("session_id")).Update("two_factor", true).Error
+	})
+	if err != nil {
+		if err == errInvalidSecondFactor {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err := loginguard.Reset(a.db, key); err != nil {
+		log.Printf("login throttle: %v", err)
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message":        "success",
+		"recovery_codes": codes,
+	})
+}
+
+type DisableTwoFactorPayload struct {
+	Password string `json:"password" binding:"required"`
+	TwoFactorCodePayload
+}
+
+// DisableTwoFactor turns 2FA off after checking the password and a second
+// factor. Admins cannot turn it off because /v1/admin requires it.
+func (a *accountImplement) DisableTwoFactor(ctx *gin.Context) {
+	id := ctx.GetInt64("id")
+	payload := DisableTwoFactorPayload{}
+	if err := ctx.ShouldBindJSON(&payload); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if ctx.GetInt("role") == model.RoleAdmin {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": "admins cannot disable two-factor authentication",
+		})
+		return
+	}
+
+	account := model.Account{}
+	if err := a.db.First(&account, id).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"error": "account not found",
+		})
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(account.Password), []byte(payload.Password)); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "wrong password",
+		})
+		return
+	}
+
+	err := a.db.Transaction(func(tx *gorm.DB) error {
+		if err := verifySecondFactor(tx, id, payload.TwoFactorCodePayload); err != nil {
+			return err
+		}
+		if err := tx.Where("account_id = ?", id).Delete(&model.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("account_id = ?", id).Delete(&model.TwoFactor{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&model.Session{}).Where("account_id = ?", id).Update("two_factor", false).Error
+	})
+	if err != nil {
+		if err == errInvalidSecondFactor {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "success",
+	})
+}
+
+// RegenerateRecoveryCodes replaces every recovery code, used or not.
+func (a *accountImplement) RegenerateRecoveryCodes(ctx *gin.Context) {
+	id := ctx.GetInt64("id")
+	payload := ConfirmTwoFactorPayload{}
+	if err := ctx.ShouldBindJSON(&payload); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	var codes []string
+	err := a.db.Transaction(func(tx *gorm.DB) error {
+		if err := verifySecondFactor(tx, id, TwoFactorCodePayload{Code: payload.Code}); err != nil {
+			return err
+		}
+
+		var err error
+		codes, err = replaceRecoveryCodes(tx, id)
+		return err
+	})
+	if err != nil {
+		if err == errInvalidSecondFactor {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message":        "success",
+		"recovery_codes": codes,
+	})
+}
+
+// replaceRecoveryCodes deletes the account's recovery codes and stores the
+// hashes of a new set. The plain codes are only ever returned here.
+func replaceRecoveryCodes(tx *gorm.DB, accountId int64) ([]string, error) {
+	if err := tx.Where("account_id = ?", accountId).Delete(&model.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	codes := make([]string, recoveryCodeCount)
+	rows := make([]model.RecoveryCode, recoveryCodeCount)
+	for i := range codes {
+		raw, err := randomToken(5)
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = raw[:5] + "-" + raw[5:]
+		rows[i] = model.RecoveryCode{
+			Account_Id: accountId,
+			Code_Hash:  hashToken(raw),
+			Time_Stamp: now,
+		}
+	}
+
+	if err := tx.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
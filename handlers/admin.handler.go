@@ -1,12 +1,20 @@
 package handlers
 
 import (
+	"errors"
+	"final-project/audit"
+	"final-project/ledger"
 	model "final-project/models"
+	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type AdminInterface interface {
@@ -14,20 +22,34 @@ type AdminInterface interface {
 	DetailUser(*gin.Context)
 	ListUserDeposito(*gin.Context)
 	TopUpUser(*gin.Context)
+	LedgerAccount(*gin.Context)
+	CreateInvitation(*gin.Context)
+	ListInvitation(*gin.Context)
+	ListRolePermission(*gin.Context)
+	UpdateRolePermission(*gin.Context)
+	UpdateAdminPosition(*gin.Context)
+	ListTopUpRequest(*gin.Context)
+	ApproveTopUpRequest(*gin.Context)
+	RejectTopUpRequest(*gin.Context)
 }
 
 type adminImplement struct {
-	db *gorm.DB
+	db             *gorm.DB
+	topUpThreshold int64
 }
 
-func NewAdmin(db *gorm.DB) AdminInterface {
+// NewAdmin builds the admin handlers. Top-ups above topUpThreshold need a
+// second admin's approval; zero disables the check.
+func NewAdmin(db *gorm.DB, topUpThreshold int64) AdminInterface {
 	return &adminImplement{
 		db,
+		topUpThreshold,
 	}
 }
 
 func (a *adminImplement) ListUserProfile(ctx *gin.Context) {
 	var user []model.User
+	audit.Describe(ctx, "user.list", 0)
 
 	if err := a.db.Find(&user).Where("role = ?", 0).Error; err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
@@ -44,6 +66,8 @@ func (a *adminImplement) ListUserProfile(ctx *gin.Context) {
 func (a *adminImplement) DetailUser(ctx *gin.Context) {
 	id := ctx.Param("id")
 	var user model.User
+	accountId, _ := strconv.ParseInt(id, 10, 64)
+	audit.Describe(ctx, "user.view", accountId)
 
 	if err := a.db.First(&user, "account_id = ?", id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
@@ -67,6 +91,7 @@ func (a *adminImplement) DetailUser(ctx *gin.Context) {
 
 func (a *adminImplement) ListUserDeposito(ctx *gin.Context) {
 	var deposit_history []model.DepositHistory
+	audit.Describe(ctx, "deposit.list", 0)
 
 	if err := a.db.Find(&deposit_history).Error; err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
@@ -82,9 +107,19 @@ func (a *adminImplement) ListUserDeposito(ctx *gin.Context) {
 
 type TransferPayload struct {
 	Username string `json:"username" binding:"required"`
-	Amount   int64  `json:"amount" binding:"required"`
+	Amount   int64  `json:"amount" binding:"required,gt=0"`
+	Reason   string `json:"reason"`
 }
 
+// topUpWindow is how far back an admin's direct top-ups to the same user are
+// added up against the approval threshold, so a large top-up cannot skip
+// approval by being split into smaller ones.
+const topUpWindow = 24 * time.Hour
+
+// TopUpUser credits a user directly while the admin's direct top-ups to that
+// user within topUpWindow, including this one, stay within the approval
+// threshold. Anything over it only creates a pending TopUpRequest that
+// another admin has to approve.
 func (a *adminImplement) TopUpUser(ctx *gin.Context) {
 	payload := TransferPayload{}
 	if err := ctx.ShouldBindJSON(&payload); err != nil {
@@ -95,7 +130,7 @@ func (a *adminImplement) TopUpUser(ctx *gin.Context) {
 	}
 
 	account := model.Account{}
-	if result := a.db.Where("username = ? AND role = ?", payload.Username, 0).First(&account); result.Error != nil {
+	if result := a.db.Where("username = ? AND role = ?", payload.Username, model.RoleUser).First(&account); result.Error != nil {
 		if result.Error == gorm.ErrRecordNotFound {
 			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{
 				"error": result.Error.Error(),
@@ -116,14 +151,186 @@ func (a *adminImplement) TopUpUser(ctx *gin.Context) {
 		return
 	}
 
-	newTransactionHistory := model.TransactionHistory{
+	audit.Describe(ctx, "user.topup", user.Account_Id)
+	makerId := ctx.GetInt64("id")
+
+	tx := a.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// The user row lock serialises top-ups to the user, so parallel requests
+	// cannot each see the other's amount missing from the total.
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, user.Id).Error; err != nil {
+		tx.Rollback()
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	var recent int64
+	if err := tx.Model(&model.TransactionHistory{}).
+		Where("maker_id = ? AND account_id = ? AND time_stamp >= ?", makerId, user.Account_Id, time.Now().Add(-topUpWindow)).
+		Select("COALESCE(SUM(amount), 0)").Scan(&recent).Error; err != nil {
+		tx.Rollback()
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if a.topUpThreshold > 0 && recent+payload.Amount > a.topUpThreshold {
+		request := model.TopUpRequest{
+			Account_Id:   user.Account_Id,
+			Amount:       payload.Amount,
+			Status:       model.TopUpRequestPending,
+			Maker_Id:     makerId,
+			Maker_Reason: payload.Reason,
+			Time_Stamp:   time.Now(),
+		}
+
+		if err := tx.Create(&request).Error; err != nil {
+			tx.Rollback()
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		if err := tx.Commit().Error; err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		audit.Describe(ctx, "user.topup.request", user.Account_Id)
+		audit.Change(ctx, nil, request)
+
+		ctx.JSON(http.StatusAccepted, gin.H{
+			"message": "top up is waiting for approval",
+			"data":    request,
+		})
+		return
+	}
+
+	before := gin.H{"balance": user.Balance}
+	if _, err := postTopUp(tx, &user, payload.Amount, &makerId); err != nil {
+		tx.Rollback()
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	audit.Change(ctx, before, gin.H{"balance": user.Balance, "amount": payload.Amount})
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"balance": user.Balance,
+	})
+}
+
+// postTopUp writes the TopUp history row and its ledger entry, then reloads
+// user so the caller sees the new balance. makerId is set for direct top-ups
+// only, since approved requests already had a second admin look at them.
+func postTopUp(tx *gorm.DB, user *model.User, amount int64, makerId *int64) (*model.TransactionHistory, error) {
+	history := model.TransactionHistory{
 		Account_Id:           user.Account_Id,
 		Transaction_Category: "TopUp",
-		Amount:               payload.Amount,
+		Amount:               amount,
 		In_Out:               0,
+		Maker_Id:             makerId,
 		Time_Stamp:           time.Now(),
 	}
 
+	if err := tx.Create(&history).Error; err != nil {
+		return nil, err
+	}
+
+	reference := fmt.Sprintf("transaction_history:%d", history.Id)
+	if _, err := ledger.Post(tx, "TopUp", reference,
+		ledger.User(user.Account_Id, amount),
+		ledger.Internal(ledger.CashAccount, -amount),
+	); err != nil {
+		return nil, err
+	}
+
+	if err := tx.First(user, user.Id).Error; err != nil {
+		return nil, err
+	}
+	return &history, nil
+}
+
+// ListTopUpRequest lists top-up requests, optionally filtered by status and
+// account_id, newest first.
+func (a *adminImplement) ListTopUpRequest(ctx *gin.Context) {
+	var requests []model.TopUpRequest
+
+	query := a.db.Order("time_stamp DESC, id DESC")
+	if status := ctx.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if accountId := ctx.Query("account_id"); accountId != "" {
+		query = query.Where("account_id = ?", accountId)
+	}
+
+	if err := query.Find(&requests).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"data": requests,
+	})
+}
+
+type TopUpDecisionPayload struct {
+	Reason string `json:"reason"`
+}
+
+func (a *adminImplement) ApproveTopUpRequest(ctx *gin.Context) {
+	a.decideTopUpRequest(ctx, model.TopUpRequestApproved)
+}
+
+func (a *adminImplement) RejectTopUpRequest(ctx *gin.Context) {
+	a.decideTopUpRequest(ctx, model.TopUpRequestRejected)
+}
+
+// decideTopUpRequest settles a pending request. The checker must be a
+// different admin from the maker, and only approval credits the user.
+func (a *adminImplement) decideTopUpRequest(ctx *gin.Context, status string) {
+	id := ctx.Param("id")
+	checkerId := ctx.GetInt64("id")
+
+	payload := TopUpDecisionPayload{}
+	if err := ctx.ShouldBindJSON(&payload); err != nil && !errors.Is(err, io.EOF) {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if status == model.TopUpRequestRejected && payload.Reason == "" {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "reason is required when rejecting",
+		})
+		return
+	}
+
 	tx := a.db.Begin()
 	defer func() {
 		if r := recover(); r != nil {
@@ -131,16 +338,64 @@ func (a *adminImplement) TopUpUser(ctx *gin.Context) {
 		}
 	}()
 
-	user.Balance += payload.Amount
-	if err := tx.Save(&user).Error; err != nil {
+	request := model.TopUpRequest{}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&request, "id = ?", id).Error; err != nil {
 		tx.Rollback()
-		ctx.JSON(http.StatusInternalServerError, gin.H{
-			"error": err.Error(),
+		ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"error": "Not found",
+		})
+		return
+	}
+
+	audit.Describe(ctx, "user.topup."+status, request.Account_Id)
+	before := request
+
+	if request.Status != model.TopUpRequestPending {
+		tx.Rollback()
+		ctx.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error": fmt.Sprintf("request is already %s", request.Status),
+		})
+		return
+	}
+
+	if request.Maker_Id == checkerId {
+		tx.Rollback()
+		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": "the maker cannot approve or reject their own request",
 		})
 		return
 	}
 
-	if err := tx.Save(&newTransactionHistory).Error; err != nil {
+	now := time.Now()
+	request.Status = status
+	request.Checker_Id = &checkerId
+	request.Checker_Reason = payload.Reason
+	request.Decided_At = &now
+
+	var balance int64
+	if status == model.TopUpRequestApproved {
+		user := model.User{}
+		if err := tx.Where("account_id = ?", request.Account_Id).First(&user).Error; err != nil {
+			tx.Rollback()
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		history, err := postTopUp(tx, &user, request.Amount, nil)
+		if err != nil {
+			tx.Rollback()
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		request.Transaction_History_Id = &history.Id
+		balance = user.Balance
+	}
+
+	if err := tx.Save(&request).Error; err != nil {
 		tx.Rollback()
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
@@ -156,8 +411,291 @@ func (a *adminImplement) TopUpUser(ctx *gin.Context) {
 		return
 	}
 
+	audit.Change(ctx, before, request)
+
+	response := gin.H{
+		"message": "success",
+		"data":    request,
+	}
+	if status == model.TopUpRequestApproved {
+		response["balance"] = balance
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// LedgerAccount shows the postings on a user's wallet next to the balance
+// derived from them and the cached User.Balance, so the two can be reconciled.
+func (a *adminImplement) LedgerAccount(ctx *gin.Context) {
+	id := ctx.Param("id")
+	var user model.User
+	accountId, _ := strconv.ParseInt(id, 10, 64)
+	audit.Describe(ctx, "user.ledger.view", accountId)
+
+	if err := a.db.First(&user, "account_id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "Not found",
+			})
+			return
+		}
+
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	var postings []model.Posting
+	if err := a.db.Where("account_id = ?", user.Account_Id).Order("id").Find(&postings).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	balance, err := ledger.Balance(a.db, user.Account_Id)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"data":           postings,
+		"ledger_balance": balance,
+		"cached_balance": user.Balance,
+	})
+}
+
+type InvitationPayload struct {
+	Position       string   `json:"position" binding:"required"`
+	Permissions    []string `json:"permissions"`
+	Expires_In_Hrs int      `json:"expires_in_hours" binding:"omitempty,min=1,max=168"`
+}
+
+const defaultInvitationTTL = 48 * time.Hour
+
+// CreateInvitation issues a single-use token another person can use to sign
+// up as an admin. The raw token is only returned here; the database keeps
+// its hash.
+func (a *adminImplement) CreateInvitation(ctx *gin.Context) {
+	payload := InvitationPayload{}
+	if err := ctx.ShouldBindJSON(&payload); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	token, err := randomToken(32)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	for _, p := range payload.Permissions {
+		if !model.IsPermission(p) {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("unknown permission %q", p),
+			})
+			return
+		}
+	}
+
+	ttl := defaultInvitationTTL
+	if payload.Expires_In_Hrs > 0 {
+		ttl = time.Duration(payload.Expires_In_Hrs) * time.Hour
+	}
+
+	now := time.Now()
+	invitation := model.AdminInvitation{
+		Token_Hash:  hashToken(token),
+		Invited_By:  ctx.GetInt64("id"),
+		Position:    strings.ToLower(payload.Position),
+		Permissions: strings.Join(payload.Permissions, ","),
+		Expires_At:  now.Add(ttl),
+		Time_Stamp:  now,
+	}
+
+	audit.Describe(ctx, "admin.invite", 0)
+
+	if err := a.db.Create(&invitation).Error; err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	audit.Change(ctx, nil, invitation)
+
 	ctx.JSON(http.StatusOK, gin.H{
 		"message": "success",
-		"balance": user.Balance,
+		"token":   token,
+		"data":    invitation,
+	})
+}
+
+func (a *adminImplement) ListInvitation(ctx *gin.Context) {
+	var invitations []model.AdminInvitation
+
+	if err := a.db.Order("id DESC").Find(&invitations).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"data": invitations,
+	})
+}
+
+// ListRolePermission shows which actions each admin position may perform.
+func (a *adminImplement) ListRolePermission(ctx *gin.Context) {
+	var grants []model.AdminRolePermission
+
+	if err := a.db.Order("position, permission").Find(&grants).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	roles := map[string][]string{}
+	for _, g := range grants {
+		roles[g.Position] = append(roles[g.Position], g.Permission)
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"data":        roles,
+		"permissions": model.Permissions,
+	})
+}
+
+type RolePermissionPayload struct {
+	Permissions []string `json:"permissions"`
+}
+
+// UpdateRolePermission replaces the set of actions granted to a position.
+// Every admin holding that position picks up the change on their next
+// request.
+func (a *adminImplement) UpdateRolePermission(ctx *gin.Context) {
+	position := strings.ToLower(ctx.Param("position"))
+
+	payload := RolePermissionPayload{}
+	if err := ctx.ShouldBindJSON(&payload); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	audit.Describe(ctx, "admin.role.update", 0)
+
+	var before []string
+	if err := a.db.Model(&model.AdminRolePermission{}).Where("position = ?", position).Order("permission").Pluck("permission", &before).Error; err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	grants := []model.AdminRolePermission{}
+	for _, p := range payload.Permissions {
+		if !model.IsPermission(p) {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("unknown permission %q", p),
+			})
+			return
+		}
+		grants = append(grants, model.AdminRolePermission{Position: position, Permission: p})
+	}
+
+	err := a.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("position = ?", position).Delete(&model.AdminRolePermission{}).Error; err != nil {
+			return err
+		}
+		if len(grants) == 0 {
+			return nil
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&grants).Error
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	audit.Change(ctx,
+		gin.H{"position": position, "permissions": before},
+		gin.H{"position": position, "permissions": payload.Permissions},
+	)
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "success",
+	})
+}
+
+type AdminPositionPayload struct {
+	Position    string   `json:"position" binding:"required"`
+	Permissions []string `json:"permissions"`
+}
+
+// UpdateAdminPosition moves an admin to another position and replaces the
+// extra permissions granted on top of it.
+func (a *adminImplement) UpdateAdminPosition(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	payload := AdminPositionPayload{}
+	if err := ctx.ShouldBindJSON(&payload); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	for _, p := range payload.Permissions {
+		if !model.IsPermission(p) {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("unknown permission %q", p),
+			})
+			return
+		}
+	}
+
+	admin := model.Admin{}
+	if err := a.db.Where("account_id = ?", id).First(&admin).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"error": "admin not found",
+		})
+		return
+	}
+
+	audit.Describe(ctx, "admin.position.update", admin.Account_Id)
+	before := admin
+
+	if admin.Account_Id == ctx.GetInt64("id") {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": "cannot change your own position",
+		})
+		return
+	}
+
+	if err := a.db.Model(&admin).Updates(map[string]interface{}{
+		"position":    strings.ToLower(payload.Position),
+		"permissions": strings.Join(payload.Permissions, ","),
+	}).Error; err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	audit.Change(ctx, before, admin)
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data":    admin,
 	})
 }
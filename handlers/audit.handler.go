@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	model "final-project/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type AuditInterface interface {
+	ListAuditLog(*gin.Context)
+}
+
+type auditImplement struct {
+	db *gorm.DB
+}
+
+func NewAudit(db *gorm.DB) AuditInterface {
+	return &auditImplement{
+		db,
+	}
+}
+
+type AuditLogQuery struct {
+	Actor_Id          *int64 `form:"actor_id"`
+	Target_Account_Id *int64 `form:"target_account_id"`
+	Action            string `form:"action"`
+	Outcome           string `form:"outcome" binding:"omitempty,oneof=success failure denied"`
+	Request_Id        string `form:"request_id"`
+	From              string `form:"from"`
+	To                string `form:"to"`
+	Cursor            string `form:"cursor"`
+	Limit             int    `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+// ListAuditLog lists admin_audit_log newest first, with the same cursor
+// pagination as the transaction history. An action ending in "*" matches
+// every action with that prefix, e.g. "user.topup*".
+func (a *auditImplement) ListAuditLog(ctx *gin.Context) {
+	query := AuditLogQuery{}
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	filtered := a.db.Model(&model.AdminAuditLog{})
+
+	if query.Actor_Id != nil {
+		filtered = filtered.Where("actor_id = ?", *query.Actor_Id)
+	}
+	if query.Target_Account_Id != nil {
+		filtered = filtered.Where("target_account_id = ?", *query.Target_Account_Id)
+	}
+	if query.Action != "" {
+		if n := len(query.Action); query.Action[n-1] == '*' {
+			filtered = filtered.Where("action LIKE ?", query.Action[:n-1]+"%")
+		} else {
+			filtered = filtered.Where("action = ?", query.Action)
+		}
+	}
+	if query.Outcome != "" {
+		filtered = filtered.Where("outcome = ?", query.Outcome)
+	}
+	if query.Request_Id != "" {
+		filtered = filtered.Where("request_id = ?", query.Request_Id)
+	}
+	if query.From != "" {
+		from, err := parseDate(query.From, false)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "invalid from date",
+			})
+			return
+		}
+		filtered = filtered.Where("time_stamp >= ?", from)
+	}
+	if query.To != "" {
+		to, err := parseDate(query.To, true)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "invalid to date",
+			})
+			return
+		}
+		filtered = filtered.Where("time_stamp < ?", to)
+	}
+
+	var total int64
+	if err := filtered.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	page := filtered.Session(&gorm.Session{})
+	if query.Cursor != "" {
+		cursorTime, cursorId, err := decodeCursor(query.Cursor)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "invalid cursor",
+			})
+			return
+		}
+		page = page.Where("(time_stamp, id) < (?, ?)", cursorTime, cursorId)
+	}
+
+	limit := query.Limit
+	if limit == 0 {
+		limit = defaultHistoryLimit
+	}
+
+	var logs []model.AdminAuditLog
+	if err := page.Order("time_stamp DESC, id DESC").Limit(limit + 1).Find(&logs).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	var nextCursor *string
+	if len(logs) > limit {
+		logs = logs[:limit]
+		last := logs[limit-1]
+		cursor := encodeCursor(last.Time_Stamp, last.Id)
+		nextCursor = &cursor
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"data":        logs,
+		"total":       total,
+		"next_cursor": nextCursor,
+	})
+}
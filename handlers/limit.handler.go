@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"errors"
+	"final-project/audit"
+	"final-project/limits"
+	model "final-project/models"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type LimitInterface interface {
+	PersonalLimit(*gin.Context)
+	ListTier(*gin.Context)
+	UpdateTier(*gin.Context)
+	UpdateUserTier(*gin.Context)
+}
+
+type limitImplement struct {
+	db *gorm.DB
+}
+
+func NewLimit(db *gorm.DB) LimitInterface {
+	return &limitImplement{
+		db,
+	}
+}
+
+// limitExceeded answers the request when err is a broken transaction limit
+// and reports whether it did.
+func limitExceeded(ctx *gin.Context, err error) bool {
+	var exceeded *limits.ExceededError
+	if !errors.As(err, &exceeded) {
+		return false
+	}
+
+	ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+		"error":     exceeded.Error(),
+		"limit":     exceeded.Limit,
+		"allowance": exceeded.Allowance,
+	})
+	return true
+}
+
+// PersonalLimit shows the caller's tier and how much they can still move
+// out today and this month.
+func (a *limitImplement) PersonalLimit(ctx *gin.Context) {
+	id := ctx.GetInt64("id")
+
+	allowance, err := limits.Remaining(a.db, id, time.Now())
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "Not found",
+			})
+			return
+		}
+
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"data": allowance,
+	})
+}
+
+func (a *limitImplement) ListTier(ctx *gin.Context) {
+	var tiers []model.LimitTier
+
+	if err := a.db.Order("code").Find(&tiers).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"data": tiers,
+	})
+}
+
+type TierPayload struct {
+	Name           string `json:"name" binding:"required"`
+	Single_Max     int64  `json:"single_max" binding:"min=0"`
+	Daily_Amount   int64  `json:"daily_amount" binding:"min=0"`
+	Daily_Count    int64  `json:"daily_count" binding:"min=0"`
+	Monthly_Amount int64  `json:"monthly_amount" binding:"min=0"`
+	Monthly_Count  int64  `json:"monthly_count" binding:"min=0"`
+}
+
+// UpdateTier creates or replaces the limits of a tier. A zero limit is not
+// enforced.
+func (a *limitImplement) UpdateTier(ctx *gin.Context) {
+	payload := TierPayload{}
+	if err := ctx.ShouldBindJSON(&payload); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	audit.Describe(ctx, "limit.tier.update", 0)
+
+	var before *model.LimitTier
+	existing := model.LimitTier{}
+	if err := a.db.Where("code = ?", ctx.Param("code")).First(&existing).Error; err == nil {
+		before = &existing
+	}
+
+	tier := model.LimitTier{
+		Code:           ctx.Param("code"),
+		Name:           payload.Name,
+		Single_Max:     payload.Single_Max,
+		Daily_Amount:   payload.Daily_Amount,
+		Daily_Count:    payload.Daily_Count,
+		Monthly_Amount: payload.Monthly_Amount,
+		Monthly_Count:  payload.Monthly_Count,
+	}
+
+	if err := a.db.Save(&tier).Error; err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	audit.Change(ctx, before, tier)
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data":    tier,
+	})
+}
+
+type UserTierPayload struct {
+	Tier string `json:"tier" binding:"required"`
+}
+
+// UpdateUserTier moves a user to another limit tier.
+func (a *limitImplement) UpdateUserTier(ctx *gin.Context) {
+	id := ctx.Param("id")
+	payload := UserTierPayload{}
+	if err := ctx.ShouldBindJSON(&payload); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	accountId, _ := strconv.ParseInt(id, 10, 64)
+	audit.Describe(ctx, "user.tier.update", accountId)
+
+	tier := model.LimitTier{}
+	if err := a.db.Where("code = ?", payload.Tier).First(&tier).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "unknown tier",
+		})
+		return
+	}
+
+	user := model.User{}
+	if err := a.db.Where("account_id = ?", id).First(&user).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"error": "Not found",
+		})
+		return
+	}
+	before := user.Tier
+
+	if err := a.db.Model(&user).Update("tier", tier.Code).Error; err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	audit.Change(ctx, gin.H{"tier": before}, gin.H{"tier": tier.Code})
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data":    user,
+	})
+}
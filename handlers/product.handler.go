@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"final-project/audit"
+	"final-project/deposit"
+	model "final-project/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type ProductInterface interface {
+	ListActiveProduct(*gin.Context)
+	ListProduct(*gin.Context)
+	CreateProduct(*gin.Context)
+	UpdateProduct(*gin.Context)
+	RetireProduct(*gin.Context)
+	Simulate(*gin.Context)
+}
+
+type productImplement struct {
+	db *gorm.DB
+}
+
+func NewProduct(db *gorm.DB) ProductInterface {
+	return &productImplement{
+		db,
+	}
+}
+
+// ListActiveProduct is the public catalog users can pick a deposito from.
+func (a *productImplement) ListActiveProduct(ctx *gin.Context) {
+	var products []model.DepositProduct
+
+	if err := a.db.Where("is_active = ?", true).Order("min_amount").Find(&products).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"data": products,
+	})
+}
+
+// ListProduct lists every product, including retired ones, for admins.
+func (a *productImplement) ListProduct(ctx *gin.Context) {
+	var products []model.DepositProduct
+
+	if err := a.db.Order("id").Find(&products).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"data": products,
+	})
+}
+
+type ProductPayload struct {
+	Code                     string  `json:"code" binding:"required"`
+	Name                     string  `json:"name" binding:"required"`
+	Min_Amount               int64   `json:"min_amount" binding:"required,gt=0"`
+	Max_Amount               int64   `json:"max_amount" binding:"required,gtefield=Min_Amount"`
+	Tenors                   []int   `json:"tenors" binding:"required,min=1,dive,gt=0"`
+	Interest_Rate            float64 `json:"interest_rate" binding:"gte=0"`
+	Early_Withdrawal_Penalty float64 `json:"early_withdrawal_penalty" binding:"gte=0,lte=100"`
+	Tax_Rate                 float64 `json:"tax_rate" binding:"gte=0,lte=100"`
+	Is_Active                *bool   `json:"is_active"`
+}
+
+func (p ProductPayload) tenors() string {
+	months := make([]string, len(p.Tenors))
+	for i, month := range p.Tenors {
+		months[i] = strconv.Itoa(month)
+	}
+	return strings.Join(months, ",")
+}
+
+func (a *productImplement) CreateProduct(ctx *gin.Context) {
+	payload := ProductPayload{}
+	if err := ctx.ShouldBindJSON(&payload); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	existing := model.DepositProduct{}
+	if result := a.db.Where("code = ?", payload.Code).First(&existing); result.RowsAffected > 0 {
+		ctx.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error": "product code already exist",
+		})
+		return
+	}
+
+	audit.Describe(ctx, "deposit.product.create", 0)
+
+	product := model.DepositProduct{
+		Code:                     payload.Code,
+		Name:                     payload.Name,
+		Min_Amount:               payload.Min_Amount,
+		Max_Amount:               payload.Max_Amount,
+		Tenors:                   payload.tenors(),
+		Interest_Rate:            payload.Interest_Rate,
+		Early_Withdrawal_Penalty: payload.Early_Withdrawal_Penalty,
+		Tax_Rate:                 payload.Tax_Rate,
+		Is_Active:                payload.Is_Active == nil || *payload.Is_Active,
+		Time_Stamp:               time.Now(),
+	}
+
+	if err := a.db.Create(&product).Error; err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	audit.Change(ctx, nil, product)
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data":    product,
+	})
+}
+
+func (a *productImplement) UpdateProduct(ctx *gin.Context) {
+	id := ctx.Param("id")
+	payload := ProductPayload{}
+	if err := ctx.ShouldBindJSON(&payload); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	product := model.DepositProduct{}
+	if err := a.db.First(&product, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "product not found",
+			})
+			return
+		}
+
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	audit.Describe(ctx, "deposit.product.update", 0)
+	before := product
+
+	existing := model.DepositProduct{}
+	if result := a.db.Where("code = ? AND id <> ?", payload.Code, product.Id).First(&existing); result.RowsAffected > 0 {
+		ctx.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error": "product code already exist",
+		})
+		return
+	}
+
+	product.Code = payload.Code
+	product.Name = payload.Name
+	product.Min_Amount = payload.Min_Amount
+	product.Max_Amount = payload.Max_Amount
+	product.Tenors = payload.tenors()
+	product.Interest_Rate = payload.Interest_Rate
+	product.Early_Withdrawal_Penalty = payload.Early_Withdrawal_Penalty
+	product.Tax_Rate = payload.Tax_Rate
+	if payload.Is_Active != nil {
+		product.Is_Active = *payload.Is_Active
+	}
+
+	if err := a.db.Save(&product).Error; err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	audit.Change(ctx, before, product)
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data":    product,
+	})
+}
+
+// RetireProduct hides a product from the catalog. It is kept in the table
+// because existing depositos still refer to it.
+func (a *productImplement) RetireProduct(ctx *gin.Context) {
+	id := ctx.Param("id")
+	audit.Describe(ctx, "deposit.product.retire", 0)
+
+	result := a.db.Model(&model.DepositProduct{}).Where("id = ?", id).Update("is_active", false)
+	if result.Error != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": result.Error.Error(),
+		})
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"error": "product not found",
+		})
+		return
+	}
+	audit.Change(ctx, gin.H{"id": id, "is_active": true}, gin.H{"id": id, "is_active": false})
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "success",
+	})
+}
+
+type SimulatePayload struct {
+	Deposito_Id string `json:"deposito_id" binding:"required"`
+	Amount      int64  `json:"amount" binding:"required"`
+	Min_Month   int    `json:"min_month" binding:"required"`
+}
+
+// Simulate projects the returns of a deposito before it is registered. It
+// accepts the same fields and limits as /v1/user/register/deposit.
+func (a *productImplement) Simulate(ctx *gin.Context) {
+	payload := SimulatePayload{}
+	if err := ctx.ShouldBindJSON(&payload); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	product, err := deposit.LookupProduct(a.db, payload.Deposito_Id, payload.Amount, payload.Min_Month)
+	if err != nil {
+		switch err {
+		case deposit.ErrProductUnknown, deposit.ErrAmountNotAcceptable, deposit.ErrTenorNotAcceptable:
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+		default:
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+		}
+		return
+	}
+
+	projection := deposit.Project(payload.Amount, product.Interest_Rate, product.Tax_Rate, time.Now(), payload.Min_Month)
+	maturity := projection[len(projection)-1]
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"product":        product,
+			"amount":         payload.Amount,
+			"tax_rate":       product.Tax_Rate,
+			"projection":     projection,
+			"maturity_date":  maturity.Date,
+			"maturity_value": maturity.Value,
+		},
+	})
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"final-project/audit"
+	"final-project/loginguard"
+	model "final-project/models"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type SecurityInterface interface {
+	ListLoginAttempt(*gin.Context)
+	UnlockAccount(*gin.Context)
+	UnlockIP(*gin.Context)
+}
+
+type securityImplement struct {
+	db *gorm.DB
+}
+
+func NewSecurity(db *gorm.DB) SecurityInterface {
+	return &securityImplement{
+		db,
+	}
+}
+
+type LoginAttemptQuery struct {
+	Username   string `form:"username"`
+	Account_Id *int64 `form:"account_id"`
+	Ip         string `form:"ip"`
+	Success    *bool  `form:"success"`
+	From       string `form:"from"`
+	To         string `form:"to"`
+	Limit      int    `form:"limit" binding:"omitempty,min=1,max=500"`
+}
+
+// ListLoginAttempt lists recorded login attempts, newest first.
+func (a *securityImplement) ListLoginAttempt(ctx *gin.Context) {
+	query := LoginAttemptQuery{}
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	audit.Describe(ctx, "login.attempt.list", 0)
+
+	filtered := a.db.Model(&model.LoginAttempt{})
+	if query.Username != "" {
+		filtered = filtered.Where("username = ?", query.Username)
+	}
+	if query.Account_Id != nil {
+		filtered = filtered.Where("account_id = ?", *query.Account_Id)
+	}
+	if query.Ip != "" {
+		filtered = filtered.Where("ip = ?", query.Ip)
+	}
+	if query.Success != nil {
+		filtered = filtered.Where("success = ?", *query.Success)
+	}
+	if query.From != "" {
+		from, err := parseDate(query.From, false)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "invalid from date",
+			})
+			return
+		}
+		filtered = filtered.Where("time_stamp >= ?", from)
+	}
+	if query.To != "" {
+		to, err := parseDate(query.To, true)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "invalid to date",
+			})
+			return
+		}
+		filtered = filtered.Where("time_stamp < ?", to)
+	}
+
+	limit := query.Limit
+	if limit == 0 {
+		limit = 100
+	}
+
+	var attempts []model.LoginAttempt
+	if err := filtered.Order("time_stamp DESC, id DESC").Limit(limit).Find(&attempts).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"data": attempts,
+	})
+}
+
+// UnlockAccount lifts both a manual lock and a failed-login lockout from an
+// account.
+func (a *securityImplement) UnlockAccount(ctx *gin.Context) {
+	id := ctx.Param("id")
+	accountId, _ := strconv.ParseInt(id, 10, 64)
+	audit.Describe(ctx, "account.unlock", accountId)
+
+	account := model.Account{}
+	if err := a.db.First(&account, "id = ?", id).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"error": "Not found",
+		})
+		return
+	}
+
+	var before *model.LoginThrottle
+	throttle := model.LoginThrottle{}
+	if err := a.db.Where("key = ?", loginguard.UserKey(account.Username)).First(&throttle).Error; err == nil {
+		before = &throttle
+	}
+
+	err := a.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&account).Update("is_locked", false).Error; err != nil {
+			return err
+		}
+		return loginguard.Reset(tx, loginguard.UserKey(account.Username))
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	audit.Change(ctx, gin.H{"throttle": before}, gin.H{"is_locked": false})
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "success",
+	})
+}
+
+type UnlockIPPayload struct {
+	Ip string `json:"ip" binding:"required"`
+}
+
+// UnlockIP lifts the failed-login lockout from a client IP.
+func (a *securityImplement) UnlockIP(ctx *gin.Context) {
+	payload := UnlockIPPayload{}
+	if err := ctx.ShouldBindJSON(&payload); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	audit.Describe(ctx, "ip.unlock", 0)
+
+	if err := loginguard.Reset(a.db, loginguard.IPKey(payload.Ip)); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	audit.Change(ctx, nil, gin.H{"ip": payload.Ip})
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "success",
+	})
+}
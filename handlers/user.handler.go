@@ -1,17 +1,26 @@
 package handlers
 
 import (
-	"bytes"
-	"encoding/json"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"final-project/deposit"
+	"final-project/httpclient"
+	"final-project/ledger"
+	"final-project/limits"
 	model "final-project/models"
-	"io"
+	"final-project/outbox"
+	"fmt"
+	"log"
 	"net/http"
-	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type UserInterface interface {
@@ -21,15 +30,23 @@ type UserInterface interface {
 	EditProfile(*gin.Context)
 	RegisterDeposit(*gin.Context)
 	PersonalDeposit(*gin.Context)
+	Transfer(*gin.Context)
+	QuoteWithdrawDeposit(*gin.Context)
+	WithdrawDeposit(*gin.Context)
+	UpdateDepositRollover(*gin.Context)
 }
 
 type userImplement struct {
-	db *gorm.DB
+	db      *gorm.DB
+	deposit deposit.Service
+	relay   *outbox.Relay
 }
 
-func NewUser(db *gorm.DB) UserInterface {
+func NewUser(db *gorm.DB, depositService deposit.Service, relay *outbox.Relay) UserInterface {
 	return &userImplement{
 		db,
+		depositService,
+		relay,
 	}
 }
 
@@ -56,23 +73,161 @@ func (a *userImplement) Profile(ctx *gin.Context) {
 	})
 }
 
-// PERLU DIBERI RENTANG TANGGAL
+type TransactionHistoryQuery struct {
+	From       string `form:"from"`
+	To         string `form:"to"`
+	Category   string `form:"category"`
+	In_Out     *int   `form:"in_out" binding:"omitempty,oneof=0 1"`
+	Min_Amount *int64 `form:"min_amount"`
+	Max_Amount *int64 `form:"max_amount"`
+	Cursor     string `form:"cursor"`
+	Limit      int    `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+const defaultHistoryLimit = 20
+
+// TransactionHistory lists the caller's transactions newest first. It is
+// paginated with an opaque cursor over (time_stamp, id) so pages stay stable
+// while new rows are inserted.
 func (a *userImplement) TransactionHistory(ctx *gin.Context) {
 	id := ctx.GetInt64("id")
-	var mutation []model.TransactionHistory
+	query := TransactionHistoryQuery{}
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
 
-	if err := a.db.Find(&mutation).Where("account_id = ?", id).Error; err != nil {
+	filtered := a.db.Model(&model.TransactionHistory{}).Where("account_id = ?", id)
+
+	if query.From != "" {
+		from, err := parseDate(query.From, false)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "invalid from date",
+			})
+			return
+		}
+		filtered = filtered.Where("time_stamp >= ?", from)
+	}
+	if query.To != "" {
+		to, err := parseDate(query.To, true)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "invalid to date",
+			})
+			return
+		}
+		filtered = filtered.Where("time_stamp < ?", to)
+	}
+	if query.Category != "" {
+		filtered = filtered.Where("transaction_category = ?", query.Category)
+	}
+	if query.In_Out != nil {
+		filtered = filtered.Where("in_out = ?", *query.In_Out)
+	}
+	if query.Min_Amount != nil {
+		filtered = filtered.Where("amount >= ?", *query.Min_Amount)
+	}
+	if query.Max_Amount != nil {
+		filtered = filtered.Where("amount <= ?", *query.Max_Amount)
+	}
+
+	var total int64
+	if err := filtered.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	page := filtered.Session(&gorm.Session{})
+	if query.Cursor != "" {
+		cursorTime, cursorId, err := decodeCursor(query.Cursor)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "invalid cursor",
+			})
+			return
+		}
+		page = page.Where("(time_stamp, id) < (?, ?)", cursorTime, cursorId)
+	}
+
+	limit := query.Limit
+	if limit == 0 {
+		limit = defaultHistoryLimit
+	}
+
+	var mutation []model.TransactionHistory
+	if err := page.Order("time_stamp DESC, id DESC").Limit(limit + 1).Find(&mutation).Error; err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
 			"error": err.Error(),
 		})
 		return
 	}
 
+	var nextCursor *string
+	if len(mutation) > limit {
+		mutation = mutation[:limit]
+		last := mutation[limit-1]
+		cursor := encodeCursor(last.Time_Stamp, last.Id)
+		nextCursor = &cursor
+	}
+
 	ctx.JSON(http.StatusOK, gin.H{
-		"data": mutation,
+		"data":        mutation,
+		"total":       total,
+		"next_cursor": nextCursor,
 	})
 }
 
+// parseDate accepts either a plain date or an RFC3339 timestamp. A plain date
+// used as an upper bound covers the whole day.
+func parseDate(value string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.ParseInLocation(time.DateOnly, value, time.Local)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+func encodeCursor(t time.Time, id int64) string {
+	raw := t.UTC().Format(time.RFC3339Nano) + "|" + strconv.FormatInt(id, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(cursor string) (time.Time, int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 {
+		return time.Time{}, 0, errors.New("malformed cursor")
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+
+	id, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+
+	return t, id, nil
+}
+
 func (a *userImplement) DepositHistory(ctx *gin.Context) {
 	id := ctx.GetInt64("id")
 	var mutation []model.DepositHistory
@@ -148,6 +303,7 @@ type DepositPayload struct {
 	Name        string `json:"name"`
 	Amount      int64  `json:"amount"`
 	Min_Month   int    `json:"min_month"`
+	Rollover    string `json:"rollover" binding:"omitempty,oneof=none principal principal_interest"`
 }
 
 func (a *userImplement) RegisterDeposit(ctx *gin.Context) {
@@ -159,35 +315,209 @@ func (a *userImplement) RegisterDeposit(ctx *gin.Context) {
 		return
 	}
 
-	switch payload.Deposito_Id {
-	case "mini":
-		if payload.Amount < 100000 || payload.Amount > 10000000 {
+	product, err := deposit.LookupProduct(a.db, payload.Deposito_Id, payload.Amount, payload.Min_Month)
+	if err != nil {
+		switch err {
+		case deposit.ErrProductUnknown, deposit.ErrAmountNotAcceptable, deposit.ErrTenorNotAcceptable:
 			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
-				"message": "amount not acceptable",
+				"message": err.Error(),
 			})
+		default:
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+		}
+		return
+	}
+
+	id := ctx.GetInt64("id")
+	depositHistory, err := a.reserveDeposit(id, payload, product)
+	if err != nil {
+		if limitExceeded(ctx, err) {
 			return
 		}
-	case "maxi":
-		if payload.Amount < 100000 || payload.Amount > 1000000000 {
+
+		switch err {
+		case gorm.ErrRecordNotFound:
+			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "user not found",
+			})
+		case errInsufficientBalance:
 			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
-				"message": "amount not acceptable",
+				"error": "insufficient balance",
+			})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+		}
+		return
+	}
+
+	// The deposit service is tried once inline so the usual case answers
+	// with the contract right away; anything else is left to the relay.
+	entry, err := a.relay.Deliver(ctx.Request.Context(), depositHistory.Outbox_Id)
+	if entry == nil {
+		log.Printf("deposit_history %d: inline delivery failed: %v", depositHistory.Id, err)
+		ctx.JSON(http.StatusAccepted, gin.H{
+			"message":    "pending",
+			"deposit_id": depositHistory.Id,
+		})
+		return
+	}
+
+	switch entry.Status {
+	case model.OutboxStatusSent:
+		if err := a.db.First(depositHistory.DepositHistory, depositHistory.Id).Error; err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
 			})
 			return
 		}
-	case "great":
-		if payload.Amount < 1000000000 || payload.Amount > 9999999999 {
-			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
-				"message": "amount not acceptable",
+		ctx.JSON(http.StatusOK, gin.H{
+			"message":     "success",
+			"deposit_id":  depositHistory.Id,
+			"contract_id": depositHistory.Contract_Id,
+		})
+	case model.OutboxStatusFailed:
+		if err := a.db.First(depositHistory.DepositHistory, depositHistory.Id).Error; err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		// A registration parked because its outcome is unknown keeps the
+		// funds reserved until it is checked and replayed.
+		if depositHistory.Status == model.DepositStatusReserved {
+			ctx.JSON(http.StatusAccepted, gin.H{
+				"message":    "pending",
+				"deposit_id": depositHistory.Id,
 			})
 			return
 		}
+		depositServiceError(ctx, err)
 	default:
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
-			"message": "deposit type not recognized",
+		ctx.JSON(http.StatusAccepted, gin.H{
+			"message":    "pending",
+			"deposit_id": depositHistory.Id,
+		})
+	}
+}
+
+var errInsufficientBalance = errors.New("insufficient balance")
+
+type reservedDeposit struct {
+	*model.DepositHistory
+	Outbox_Id int64
+}
+
+// reserveDeposit moves the deposit amount from the user's wallet into the
+// reserve account under a row lock and queues the registration call to the
+// deposit service in the same transaction.
+func (a *userImplement) reserveDeposit(accountId int64, payload DepositPayload, product model.DepositProduct) (*reservedDeposit, error) {
+	if payload.Rollover == "" {
+		payload.Rollover = model.RolloverNone
+	}
+
+	depositHistory := model.DepositHistory{
+		Deposit_Id:    payload.Deposito_Id,
+		Account_Id:    accountId,
+		Deposit_Name:  payload.Name,
+		Amount:        payload.Amount,
+		Time_Period:   payload.Min_Month,
+		Interest_Rate: product.Interest_Rate,
+		Tax_Rate:      product.Tax_Rate,
+		Rollover:      payload.Rollover,
+		Status:        model.DepositStatusReserved,
+		Time_Stamp:    time.Now(),
+	}
+
+	var outboxId int64
+	err := a.db.Transaction(func(tx *gorm.DB) error {
+		var user model.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("account_id = ?", accountId).First(&user).Error; err != nil {
+			return err
+		}
+
+		if err := limits.Check(tx, accountId, payload.Amount); err != nil {
+			return err
+		}
+
+		if user.Balance < payload.Amount {
+			return errInsufficientBalance
+		}
+
+		if err := tx.Create(&depositHistory).Error; err != nil {
+			return err
+		}
+
+		reference := depositReference(&depositHistory)
+		if _, err := ledger.Post(tx, "DepositoReserve", reference,
+			ledger.User(accountId, -payload.Amount),
+			ledger.Internal(ledger.ReserveAccount, payload.Amount),
+		); err != nil {
+			return err
+		}
+
+		entry, err := outbox.Enqueue(tx, outbox.EventDepositCreate, depositHistory.Id, reference, deposit.Request{
+			Deposito_Id: payload.Deposito_Id,
+			Account_Id:  strconv.FormatInt(accountId, 10),
+			Name:        payload.Name,
+			Amount:      payload.Amount,
+			Min_Month:   payload.Min_Month,
+			Reference:   reference,
+		})
+		if err != nil {
+			return err
+		}
+		outboxId = entry.Id
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &reservedDeposit{&depositHistory, outboxId}, nil
+}
+
+// depositServiceError maps a failure of the deposit service to a gateway
+// status: 503 while the circuit breaker is open, 504 on timeout and 502 when
+// the service is unreachable or answers with an error.
+func depositServiceError(ctx *gin.Context, err error) {
+	var apiErr *deposit.APIError
+	var unreachable *httpclient.UnreachableError
+
+	switch {
+	case errors.As(err, &apiErr):
+		ctx.JSON(http.StatusBadGateway, gin.H{
+			"error":  "API request failed",
+			"status": apiErr.Status,
+		})
+	case errors.Is(err, httpclient.ErrCircuitOpen):
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": err.Error(),
+		})
+	case errors.Is(err, httpclient.ErrTimeout):
+		ctx.JSON(http.StatusGatewayTimeout, gin.H{
+			"error": err.Error(),
+		})
+	case errors.As(err, &unreachable):
+		ctx.JSON(http.StatusBadGateway, gin.H{
+			"error": err.Error(),
+		})
+	default:
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
 		})
-		return
 	}
+}
 
+func depositReference(depositHistory *model.DepositHistory) string {
+	return fmt.Sprintf("deposit_history:%d", depositHistory.Id)
+}
+
+func (a *userImplement) PersonalDeposit(ctx *gin.Context) {
 	id := ctx.GetInt64("id")
 	var user model.User
 	if err := a.db.Where("account_id = ?", id).First(&user).Error; err != nil {
@@ -204,59 +534,63 @@ func (a *userImplement) RegisterDeposit(ctx *gin.Context) {
 		return
 	}
 
-	server := os.Getenv("SERVER_API")
-	apiURL := server + "/deposito"
-
-	jsonData, err := json.Marshal(payload)
+	deposits, err := a.deposit.ListByAccount(ctx.Request.Context(), id)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{
-			"error": "failed to marshal JSON",
-		})
+		depositServiceError(ctx, err)
 		return
 	}
 
-	req, err := http.NewRequest("POST", apiURL, bytes.NewBuffer(jsonData))
-	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{
-			"error": "failed to create request",
+	ctx.JSON(http.StatusOK, gin.H{
+		"data": deposits,
+	})
+}
+
+type UserTransferPayload struct {
+	Account_Number int64 `json:"account_number" binding:"required"`
+	Amount         int64 `json:"amount" binding:"required,gt=0"`
+}
+
+// Transfer moves funds from the caller to the user owning the given account
+// number. Both wallets are locked in account_id order so two opposite
+// transfers cannot deadlock each other.
+func (a *userImplement) Transfer(ctx *gin.Context) {
+	id := ctx.GetInt64("id")
+	payload := UserTransferPayload{}
+	if err := ctx.ShouldBindJSON(&payload); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
 		})
 		return
 	}
-	req.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
+	var receiver model.User
+	if err := a.db.Where("account_number = ?", payload.Account_Number).First(&receiver).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "account number not found",
+			})
+			return
+		}
+
 		ctx.JSON(http.StatusBadRequest, gin.H{
 			"error": err.Error(),
 		})
 		return
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		ctx.JSON(http.StatusBadRequest, gin.H{
-			"error":  "API request failed",
-			"status": resp.StatusCode,
+	if receiver.Account_Id == id {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "cannot transfer to your own account",
 		})
 		return
 	}
 
-	newDepositHistory := model.DepositHistory{
-		Deposit_Id:   payload.Deposito_Id,
-		Account_Id:   id,
-		Deposit_Name: payload.Name,
-		Amount:       payload.Amount,
-		Time_Period:  payload.Min_Month,
-		Time_Stamp:   time.Now(),
-	}
-
-	newTransactionHistory := model.TransactionHistory{
-		Account_Id:           id,
-		Transaction_Category: "Deposito",
-		Amount:               payload.Amount,
-		In_Out:               1,
-		Time_Stamp:           time.Now(),
+	reference, err := transferReference()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
 	}
 
 	tx := a.db.Begin()
@@ -266,7 +600,68 @@ func (a *userImplement) RegisterDeposit(ctx *gin.Context) {
 		}
 	}()
 
-	if err := tx.Create(&newDepositHistory).Error; err != nil {
+	var locked []model.User
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("account_id IN ?", []int64{id, receiver.Account_Id}).Order("account_id").Find(&locked).Error; err != nil {
+		tx.Rollback()
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	var sender *model.User
+	for i := range locked {
+		if locked[i].Account_Id == id {
+			sender = &locked[i]
+		}
+	}
+	if sender == nil || len(locked) != 2 {
+		tx.Rollback()
+		ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"error": "user not found",
+		})
+		return
+	}
+
+	if err := limits.Check(tx, id, payload.Amount); err != nil {
+		tx.Rollback()
+		if !limitExceeded(ctx, err) {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+		}
+		return
+	}
+
+	if sender.Balance < payload.Amount {
+		tx.Rollback()
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "insufficient balance",
+		})
+		return
+	}
+
+	now := time.Now()
+	histories := []model.TransactionHistory{
+		{
+			Account_Id:           id,
+			Transaction_Category: "Transfer",
+			Amount:               payload.Amount,
+			In_Out:               1,
+			Reference:            reference,
+			Time_Stamp:           now,
+		},
+		{
+			Account_Id:           receiver.Account_Id,
+			Transaction_Category: "Transfer",
+			Amount:               payload.Amount,
+			In_Out:               0,
+			Reference:            reference,
+			Time_Stamp:           now,
+		},
+	}
+
+	if err := tx.Create(&histories).Error; err != nil {
 		tx.Rollback()
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
@@ -274,7 +669,10 @@ func (a *userImplement) RegisterDeposit(ctx *gin.Context) {
 		return
 	}
 
-	if err := tx.Create(&newTransactionHistory).Error; err != nil {
+	if _, err := ledger.Post(tx, "Transfer", reference,
+		ledger.User(id, -payload.Amount),
+		ledger.User(receiver.Account_Id, payload.Amount),
+	); err != nil {
 		tx.Rollback()
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
@@ -291,17 +689,30 @@ func (a *userImplement) RegisterDeposit(ctx *gin.Context) {
 	}
 
 	ctx.JSON(http.StatusOK, gin.H{
-		"message": "success",
+		"message":   "success",
+		"reference": reference,
+		"balance":   sender.Balance - payload.Amount,
 	})
 }
 
-func (a *userImplement) PersonalDeposit(ctx *gin.Context) {
+func transferReference() (string, error) {
+	buf := make([]byte, 6)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "TRF" + strings.ToUpper(hex.EncodeToString(buf)), nil
+}
+
+// QuoteWithdrawDeposit shows what the caller would get for breaking one of
+// their depositos today, without changing anything.
+func (a *userImplement) QuoteWithdrawDeposit(ctx *gin.Context) {
 	id := ctx.GetInt64("id")
-	var user model.User
-	if err := a.db.Where("account_id = ?", id).First(&user).Error; err != nil {
+
+	var depositHistory model.DepositHistory
+	if err := a.db.Where("id = ? AND account_id = ?", ctx.Param("id"), id).First(&depositHistory).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{
-				"error": "user not found",
+				"error": "deposit not found",
 			})
 			return
 		}
@@ -312,45 +723,159 @@ func (a *userImplement) PersonalDeposit(ctx *gin.Context) {
 		return
 	}
 
-	server := os.Getenv("SERVER_API") + "/deposito/" + strconv.FormatInt(id, 10)
-	response, err := http.Get(server)
-	if err != nil {
+	var product model.DepositProduct
+	if err := a.db.Where("code = ?", depositHistory.Deposit_Id).First(&product).Error; err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
-			"error": "failed to create request",
+			"error": err.Error(),
 		})
 		return
 	}
-	defer response.Body.Close()
 
-	if response.StatusCode != http.StatusOK {
-		ctx.JSON(http.StatusBadRequest, gin.H{
-			"error":  "API request failed",
-			"status": response.StatusCode,
+	quote, err := deposit.QuoteWithdrawal(depositHistory, product, time.Now())
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
 		})
 		return
 	}
 
-	body, err := io.ReadAll(response.Body)
-	if err != nil {
+	ctx.JSON(http.StatusOK, gin.H{
+		"data": quote,
+	})
+}
+
+// WithdrawDeposit breaks one of the caller's depositos before maturity and
+// credits principal plus accrued interest, minus the penalty, to their balance.
+func (a *userImplement) WithdrawDeposit(ctx *gin.Context) {
+	id := ctx.GetInt64("id")
+
+	tx := a.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var depositHistory model.DepositHistory
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ? AND account_id = ?", ctx.Param("id"), id).First(&depositHistory).Error; err != nil {
+		tx.Rollback()
+		if err == gorm.ErrRecordNotFound {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "deposit not found",
+			})
+			return
+		}
+
 		ctx.JSON(http.StatusBadRequest, gin.H{
 			"error": err.Error(),
 		})
 		return
 	}
 
-	var data struct {
-		Data []model.Deposit `json:"data"`
+	var product model.DepositProduct
+	if err := tx.Where("code = ?", depositHistory.Deposit_Id).First(&product).Error; err != nil {
+		tx.Rollback()
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
 	}
 
-	err = json.Unmarshal(body, &data)
+	quote, err := deposit.Withdraw(tx, &depositHistory, product, time.Now())
 	if err != nil {
+		tx.Rollback()
+		if err == deposit.ErrNotActive || err == deposit.ErrMatured {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data":    quote,
+	})
+}
+
+type RolloverPayload struct {
+	Rollover string `json:"rollover" binding:"required,oneof=none principal principal_interest"`
+}
+
+// UpdateDepositRollover changes what happens to one of the caller's depositos
+// at maturity. It can be changed as long as the deposito has not matured.
+func (a *userImplement) UpdateDepositRollover(ctx *gin.Context) {
+	id := ctx.GetInt64("id")
+	payload := RolloverPayload{}
+	if err := ctx.ShouldBindJSON(&payload); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	tx := a.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var depositHistory model.DepositHistory
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ? AND account_id = ?", ctx.Param("id"), id).First(&depositHistory).Error; err != nil {
+		tx.Rollback()
+		if err == gorm.ErrRecordNotFound {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "deposit not found",
+			})
+			return
+		}
+
 		ctx.JSON(http.StatusBadRequest, gin.H{
 			"error": err.Error(),
 		})
 		return
 	}
 
+	maturity := deposit.MaturityDate(depositHistory.Time_Stamp, depositHistory.Time_Period)
+	if depositHistory.Status != model.DepositStatusActive || !deposit.Day(time.Now()).Before(maturity) {
+		tx.Rollback()
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "rollover can only be changed before maturity",
+		})
+		return
+	}
+
+	if err := tx.Model(&depositHistory).Update("rollover", payload.Rollover).Error; err != nil {
+		tx.Rollback()
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
 	ctx.JSON(http.StatusOK, gin.H{
-		"data": data.Data,
+		"message": "success",
+		"data":    depositHistory,
 	})
 }
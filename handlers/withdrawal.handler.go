@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"errors"
+	"final-project/audit"
+	model "final-project/models"
+	"final-project/withdrawal"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type WithdrawalInterface interface {
+	Withdraw(*gin.Context)
+	PersonalWithdrawal(*gin.Context)
+	TellerWithdraw(*gin.Context)
+	ListWithdrawal(*gin.Context)
+	CompleteWithdrawal(*gin.Context)
+	FailWithdrawal(*gin.Context)
+}
+
+type withdrawalImplement struct {
+	db        *gorm.DB
+	maxAmount int64
+}
+
+// NewWithdrawal builds the withdrawal handlers. maxAmount caps a single
+// withdrawal; zero means no cap.
+func NewWithdrawal(db *gorm.DB, maxAmount int64) WithdrawalInterface {
+	return &withdrawalImplement{
+		db,
+		maxAmount,
+	}
+}
+
+type WithdrawPayload struct {
+	Amount      int64  `json:"amount" binding:"required,gt=0"`
+	Destination string `json:"destination" binding:"required"`
+}
+
+// Withdraw debits the caller's wallet and leaves the withdrawal pending until
+// the payout to the destination is settled.
+func (a *withdrawalImplement) Withdraw(ctx *gin.Context) {
+	id := ctx.GetInt64("id")
+	payload := WithdrawPayload{}
+	if err := ctx.ShouldBindJSON(&payload); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	var created *model.Withdrawal
+	err := a.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		created, err = withdrawal.Create(tx, withdrawal.Request{
+			Account_Id:  id,
+			Amount:      payload.Amount,
+			Channel:     model.WithdrawalChannelUser,
+			Destination: payload.Destination,
+		}, a.maxAmount)
+		return err
+	})
+	if err != nil {
+		a.withdrawalError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusAccepted, gin.H{
+		"message": "withdrawal is pending",
+		"data":    created,
+	})
+}
+
+// PersonalWithdrawal lists the caller's withdrawals, newest first.
+func (a *withdrawalImplement) PersonalWithdrawal(ctx *gin.Context) {
+	id := ctx.GetInt64("id")
+	var withdrawals []model.Withdrawal
+
+	if err := a.db.Where("account_id = ?", id).Order("time_stamp DESC, id DESC").Find(&withdrawals).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"data": withdrawals,
+	})
+}
+
+type TellerWithdrawPayload struct {
+	Username string `json:"username" binding:"required"`
+	Amount   int64  `json:"amount" binding:"required,gt=0"`
+}
+
+// TellerWithdraw pays a customer out over the counter. The cash changes hands
+// at once, so the withdrawal is completed in the same transaction.
+func (a *withdrawalImplement) TellerWithdraw(ctx *gin.Context) {
+	tellerId := ctx.GetInt64("id")
+	payload := TellerWithdrawPayload{}
+	if err := ctx.ShouldBindJSON(&payload); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	account := model.Account{}
+	if err := a.db.Where("username = ? AND role = ?", payload.Username, model.RoleUser).First(&account).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"error": "user not found",
+		})
+		return
+	}
+	audit.Describe(ctx, "user.withdraw", account.Id)
+
+	var created *model.Withdrawal
+	err := a.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		created, err = withdrawal.Create(tx, withdrawal.Request{
+			Account_Id:  account.Id,
+			Amount:      payload.Amount,
+			Channel:     model.WithdrawalChannelTeller,
+			Destination: "cash",
+			Teller_Id:   &tellerId,
+		}, a.maxAmount)
+		if err != nil {
+			return err
+		}
+		return withdrawal.Complete(tx, created, &tellerId)
+	})
+	if err != nil {
+		a.withdrawalError(ctx, err)
+		return
+	}
+	audit.Change(ctx, nil, created)
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data":    created,
+	})
+}
+
+// ListWithdrawal lists every withdrawal, optionally filtered by status and
+// account_id.
+func (a *withdrawalImplement) ListWithdrawal(ctx *gin.Context) {
+	var withdrawals []model.Withdrawal
+	audit.Describe(ctx, "withdrawal.list", 0)
+
+	query := a.db.Order("time_stamp DESC, id DESC")
+	if status := ctx.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if accountId := ctx.Query("account_id"); accountId != "" {
+		query = query.Where("account_id = ?", accountId)
+	}
+
+	if err := query.Find(&withdrawals).Error; err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"data": withdrawals,
+	})
+}
+
+func (a *withdrawalImplement) CompleteWithdrawal(ctx *gin.Context) {
+	a.settleWithdrawal(ctx, model.WithdrawalCompleted)
+}
+
+func (a *withdrawalImplement) FailWithdrawal(ctx *gin.Context) {
+	a.settleWithdrawal(ctx, model.WithdrawalFailed)
+}
+
+type SettleWithdrawalPayload struct {
+	Reason string `json:"reason"`
+}
+
+// settleWithdrawal closes a pending withdrawal once the payout has either
+// gone through or bounced.
+func (a *withdrawalImplement) settleWithdrawal(ctx *gin.Context, status string) {
+	adminId := ctx.GetInt64("id")
+	payload := SettleWithdrawalPayload{}
+	if err := ctx.ShouldBindJSON(&payload); err != nil && !errors.Is(err, io.EOF) {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if status == model.WithdrawalFailed && payload.Reason == "" {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "reason is required when failing a withdrawal",
+		})
+		return
+	}
+
+	var settled *model.Withdrawal
+	err := a.db.Transaction(func(tx *gorm.DB) error {
+		locked, err := withdrawal.Lock(tx, ctx.Param("id"))
+		if err != nil {
+			return err
+		}
+		audit.Describe(ctx, "withdrawal."+status, locked.Account_Id)
+		before := *locked
+		settled = locked
+
+		if status == model.WithdrawalCompleted {
+			err = withdrawal.Complete(tx, locked, &adminId)
+		} else {
+			err = withdrawal.Fail(tx, locked, &adminId, payload.Reason)
+		}
+		if err != nil {
+			return err
+		}
+
+		audit.Change(ctx, before, *locked)
+		return nil
+	})
+	if err != nil {
+		a.withdrawalError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data":    settled,
+	})
+}
+
+func (a *withdrawalImplement) withdrawalError(ctx *gin.Context, err error) {
+	if limitExceeded(ctx, err) {
+		return
+	}
+
+	switch {
+	case errors.Is(err, withdrawal.ErrInsufficientBalance):
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+	case errors.Is(err, withdrawal.ErrLimitExceeded):
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+			"limit": a.maxAmount,
+		})
+	case errors.Is(err, withdrawal.ErrUserNotFound), errors.Is(err, gorm.ErrRecordNotFound):
+		ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"error": "Not found",
+		})
+	case errors.Is(err, withdrawal.ErrNotPending):
+		ctx.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error": err.Error(),
+		})
+	default:
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+	}
+}
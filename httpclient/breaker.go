@@ -0,0 +1,68 @@
+package httpclient
+
+import (
+	"sync"
+	"time"
+)
+
+// breaker opens after a run of consecutive failures and rejects calls until
+// openTimeout has passed. It then lets a single trial call through: success
+// closes it again, failure keeps it open for another openTimeout.
+type breaker struct {
+	mu          sync.Mutex
+	threshold   int
+	openTimeout time.Duration
+	failures    int
+	openedAt    time.Time
+	trial       bool
+}
+
+func newBreaker(threshold int, openTimeout time.Duration) *breaker {
+	return &breaker{
+		threshold:   threshold,
+		openTimeout: openTimeout,
+	}
+}
+
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return true
+	}
+	if b.trial || time.Since(b.openedAt) < b.openTimeout {
+		return false
+	}
+
+	b.trial = true
+	return true
+}
+
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.trial = false
+}
+
+// release ends a call without counting it, so a cancelled trial call does not
+// keep the breaker half-open.
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+}
+
+func (b *breaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.trial = false
+	if b.failures >= b.threshold {
+		b.openedAt = time.Now()
+	}
+}
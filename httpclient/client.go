@@ -0,0 +1,210 @@
+// Package httpclient is the HTTP client used to talk to external services.
+// Every call is bounded by a timeout derived from the caller's context,
+// idempotent calls are retried with jittered backoff, and a circuit breaker
+// stops calling a service that keeps failing.
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+var (
+	// ErrCircuitOpen is returned without calling the service while the
+	// breaker is open.
+	ErrCircuitOpen = errors.New("upstream service unavailable: circuit open")
+	// ErrTimeout is returned when the service did not answer in time.
+	ErrTimeout = errors.New("upstream service timed out")
+)
+
+// UnreachableError wraps transport failures such as refused connections.
+type UnreachableError struct {
+	Err error
+}
+
+func (e *UnreachableError) Error() string {
+	return fmt.Sprintf("upstream service unreachable: %v", e.Err)
+}
+
+func (e *UnreachableError) Unwrap() error {
+	return e.Err
+}
+
+type Options struct {
+	Timeout          time.Duration
+	MaxRetries       int
+	BaseDelay        time.Duration
+	FailureThreshold int
+	OpenTimeout      time.Duration
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Timeout:          5 * time.Second,
+		MaxRetries:       2,
+		BaseDelay:        100 * time.Millisecond,
+		FailureThreshold: 5,
+		OpenTimeout:      30 * time.Second,
+	}
+}
+
+type Response struct {
+	StatusCode int
+	Body       []byte
+}
+
+type Client struct {
+	http    *http.Client
+	options Options
+	breaker *breaker
+}
+
+// New returns a client using options. Non-positive durations and a
+// non-positive FailureThreshold fall back to DefaultOptions: a zero breaker
+// would open on the first error and retry at once, and the jittered backoff
+// needs a positive upper bound.
+func New(options Options) *Client {
+	defaults := DefaultOptions()
+	if options.Timeout <= 0 {
+		options.Timeout = defaults.Timeout
+	}
+	if options.BaseDelay <= 0 {
+		options.BaseDelay = defaults.BaseDelay
+	}
+	if options.FailureThreshold <= 0 {
+		options.FailureThreshold = defaults.FailureThreshold
+	}
+	if options.OpenTimeout <= 0 {
+		options.OpenTimeout = defaults.OpenTimeout
+	}
+
+	return &Client{
+		http:    &http.Client{},
+		options: options,
+		breaker: newBreaker(options.FailureThreshold, options.OpenTimeout),
+	}
+}
+
+// Do sends the request and reads the whole response. Only idempotent calls
+// are retried, on transport errors, timeouts and 502/503/504 responses.
+func (c *Client) Do(ctx context.Context, method, url string, header http.Header, body []byte, idempotent bool) (*Response, error) {
+	attempts := 1
+	if idempotent {
+		attempts += c.options.MaxRetries
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			if err := c.sleep(ctx, attempt); err != nil {
+				return nil, lastErr
+			}
+		}
+
+		if !c.breaker.allow() {
+			return nil, ErrCircuitOpen
+		}
+
+		resp, err := c.do(ctx, method, url, header, body)
+		if err == nil && !retryableStatus(resp.StatusCode) {
+			c.breaker.success()
+			return resp, nil
+		}
+		if err != nil && errors.Is(ctx.Err(), context.Canceled) {
+			// The caller gave up, which says nothing about the service.
+			c.breaker.release()
+			return nil, err
+		}
+		c.breaker.failure()
+
+		if err == nil {
+			// A gateway error after the last attempt is handed back as a
+			// response so the caller can report the upstream status.
+			if attempt == attempts-1 {
+				return resp, nil
+			}
+			lastErr = fmt.Errorf("upstream service responded with status %d", resp.StatusCode)
+			continue
+		}
+
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	return nil, lastErr
+}
+
+func (c *Client) do(ctx context.Context, method, url string, header http.Header, body []byte) (*Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.options.Timeout)
+	defer cancel()
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, ErrTimeout
+		}
+		return nil, &UnreachableError{Err: err}
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, ErrTimeout
+		}
+		return nil, &UnreachableError{Err: err}
+	}
+
+	return &Response{
+		StatusCode: resp.StatusCode,
+		Body:       data,
+	}, nil
+}
+
+// sleep waits a random time up to BaseDelay * 2^attempt ("full jitter") so
+// retrying clients do not hit the service in lockstep.
+func (c *Client) sleep(ctx context.Context, attempt int) error {
+	limit := int64(c.options.BaseDelay) << attempt
+	if limit <= 0 {
+		limit = int64(c.options.BaseDelay)
+	}
+	delay := time.Duration(rand.Int63n(limit))
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func retryableStatus(status int) bool {
+	return status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+}
@@ -0,0 +1,130 @@
+// Package ledger records every money movement as a balanced journal entry.
+//
+// Each entry is made of postings whose signed amounts sum to zero. A positive
+// amount increases the ledger account and a negative amount decreases it.
+// User.Balance is a cached projection of the postings on the user's wallet
+// account and is only ever changed from here, inside the caller's transaction.
+package ledger
+
+import (
+	"errors"
+	model "final-project/models"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Internal ledger accounts that balance the user wallets.
+const (
+	CashAccount            = "cash"
+	ReserveAccount         = "deposit_reserve"
+	DepositAccount         = "deposit"
+	InterestAccount        = "interest_expense"
+	InterestPayableAccount = "interest_payable"
+	PenaltyAccount         = "penalty_income"
+	TaxPayableAccount      = "tax_payable"
+	WithdrawalAccount      = "withdrawal_clearing"
+)
+
+var (
+	ErrUnbalanced = errors.New("ledger: postings do not sum to zero")
+	ErrEmptyEntry = errors.New("ledger: an entry needs at least two postings")
+	ErrZeroAmount = errors.New("ledger: posting amount cannot be zero")
+)
+
+type Posting struct {
+	Account   string
+	AccountId *int64
+	Amount    int64
+}
+
+// User returns a posting on the wallet of the given account.
+func User(accountId int64, amount int64) Posting {
+	return Posting{
+		Account:   fmt.Sprintf("user:%d", accountId),
+		AccountId: &accountId,
+		Amount:    amount,
+	}
+}
+
+// Internal returns a posting on one of the bank's own ledger accounts.
+func Internal(account string, amount int64) Posting {
+	return Posting{
+		Account: account,
+		Amount:  amount,
+	}
+}
+
+// Post writes a journal entry with its postings and updates the balance
+// projection of every user wallet it touches. It must run inside the caller's
+// transaction so the entry commits or rolls back with the rest of the work.
+func Post(tx *gorm.DB, category, reference string, postings ...Posting) (*model.JournalEntry, error) {
+	if len(postings) < 2 {
+		return nil, ErrEmptyEntry
+	}
+
+	var sum int64
+	for _, p := range postings {
+		if p.Amount == 0 {
+			return nil, ErrZeroAmount
+		}
+		sum += p.Amount
+	}
+	if sum != 0 {
+		return nil, ErrUnbalanced
+	}
+
+	entry := model.JournalEntry{
+		Category:   category,
+		Reference:  reference,
+		Time_Stamp: time.Now(),
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		return nil, err
+	}
+
+	for _, p := range postings {
+		posting := model.Posting{
+			Journal_Entry_Id: entry.Id,
+			Ledger_Account:   p.Account,
+			Account_Id:       p.AccountId,
+			Amount:           p.Amount,
+		}
+		if err := tx.Create(&posting).Error; err != nil {
+			return nil, err
+		}
+
+		if p.AccountId == nil {
+			continue
+		}
+		if err := tx.Model(&model.User{}).Where("account_id = ?", *p.AccountId).Update("balance", gorm.Expr("balance + ?", p.Amount)).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	return &entry, nil
+}
+
+// Balance derives the wallet balance of an account from its postings.
+func Balance(db *gorm.DB, accountId int64) (int64, error) {
+	var balance int64
+	err := db.Model(&model.Posting{}).Where("account_id = ?", accountId).Select("COALESCE(SUM(amount), 0)").Scan(&balance).Error
+	return balance, err
+}
+
+// Rebuild resets the cached User.Balance of an account to the value derived
+// from the ledger. Balances from before the ledger are covered by the
+// OpeningBalance entries posted by migration 0016.
+func Rebuild(tx *gorm.DB, accountId int64) (int64, error) {
+	balance, err := Balance(tx, accountId)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Model(&model.User{}).Where("account_id = ?", accountId).Update("balance", balance).Error; err != nil {
+		return 0, err
+	}
+
+	return balance, nil
+}
@@ -0,0 +1,158 @@
+// Package limits enforces the per-tier caps on money leaving a user wallet.
+//
+// Usage is measured from the ledger, so every outgoing movement counts no
+// matter which endpoint posted it, and reversed movements give their amount
+// back to the window they were spent in. Check must be called inside the
+// debiting transaction after the wallet row is locked, so concurrent debits
+// cannot both pass.
+package limits
+
+import (
+	model "final-project/models"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Journal categories that debit a wallet on the customer's behalf, and the
+// ones that return such a debit.
+var (
+	OutgoingCategories = []string{"Transfer", "Withdrawal", "DepositoReserve"}
+	ReversalCategories = []string{"WithdrawalReversal", "DepositoRelease"}
+)
+
+// Limit names reported in ExceededError.
+const (
+	LimitSingle        = "single_max"
+	LimitDailyAmount   = "daily_amount"
+	LimitDailyCount    = "daily_count"
+	LimitMonthlyAmount = "monthly_amount"
+	LimitMonthlyCount  = "monthly_count"
+)
+
+// Allowance is what a user may still move out. A nil field has no limit.
+type Allowance struct {
+	Tier                     string `json:"tier"`
+	Single_Max               *int64 `json:"single_max"`
+	Daily_Amount_Remaining   *int64 `json:"daily_amount_remaining"`
+	Daily_Count_Remaining    *int64 `json:"daily_count_remaining"`
+	Monthly_Amount_Remaining *int64 `json:"monthly_amount_remaining"`
+	Monthly_Count_Remaining  *int64 `json:"monthly_count_remaining"`
+}
+
+// ExceededError reports which limit a debit would break and what is left.
+type ExceededError struct {
+	Limit     string
+	Allowance *Allowance
+}
+
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("transaction limit exceeded: %s", e.Limit)
+}
+
+type usage struct {
+	Amount int64
+	Count  int64
+}
+
+// Remaining returns the allowance of the account as of now.
+func Remaining(db *gorm.DB, accountId int64, now time.Time) (*Allowance, error) {
+	var user model.User
+	if err := db.Where("account_id = ?", accountId).First(&user).Error; err != nil {
+		return nil, err
+	}
+
+	var tier model.LimitTier
+	if err := db.Where("code = ?", user.Tier).First(&tier).Error; err != nil {
+		return nil, err
+	}
+
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+
+	daily, err := usedSince(db, accountId, dayStart)
+	if err != nil {
+		return nil, err
+	}
+	monthly, err := usedSince(db, accountId, monthStart)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Allowance{
+		Tier:                     tier.Code,
+		Single_Max:               remaining(tier.Single_Max, 0),
+		Daily_Amount_Remaining:   remaining(tier.Daily_Amount, daily.Amount),
+		Daily_Count_Remaining:    remaining(tier.Daily_Count, daily.Count),
+		Monthly_Amount_Remaining: remaining(tier.Monthly_Amount, monthly.Amount),
+		Monthly_Count_Remaining:  remaining(tier.Monthly_Count, monthly.Count),
+	}, nil
+}
+
+// Check returns an *ExceededError when debiting amount from the account
+// would break one of its tier's limits.
+func Check(tx *gorm.DB, accountId int64, amount int64) error {
+	allowance, err := Remaining(tx, accountId, time.Now())
+	if err != nil {
+		return err
+	}
+
+	checks := []struct {
+		name  string
+		left  *int64
+		spend int64
+	}{
+		{LimitSingle, allowance.Single_Max, amount},
+		{LimitDailyAmount, allowance.Daily_Amount_Remaining, amount},
+		{LimitDailyCount, allowance.Daily_Count_Remaining, 1},
+		{LimitMonthlyAmount, allowance.Monthly_Amount_Remaining, amount},
+		{LimitMonthlyCount, allowance.Monthly_Count_Remaining, 1},
+	}
+
+	for _, c := range checks {
+		if c.left != nil && c.spend > *c.left {
+			return &ExceededError{Limit: c.name, Allowance: allowance}
+		}
+	}
+	return nil
+}
+
+// usedSince sums the outgoing movements since the given time. A reversal only
+// gives its amount back when the debit it reverses, found by reference, is in
+// the same window; otherwise a debit from an earlier window that failed now
+// would add allowance it never used.
+func usedSince(db *gorm.DB, accountId int64, since time.Time) (usage, error) {
+	var u usage
+	err := db.Raw(`
+		SELECT
+			COALESCE(SUM(-p.amount) FILTER (WHERE je.category IN ? AND p.amount < 0), 0)
+				- COALESCE(SUM(p.amount) FILTER (WHERE je.category IN ? AND p.amount > 0 AND reversed.in_window), 0) AS amount,
+			COUNT(*) FILTER (WHERE je.category IN ? AND p.amount < 0) AS count
+		FROM posting p
+		JOIN journal_entry je ON je.id = p.journal_entry_id
+		LEFT JOIN LATERAL (
+			SELECT TRUE AS in_window
+			FROM journal_entry oje
+			JOIN posting op ON op.journal_entry_id = oje.id
+			WHERE je.reference <> '' AND oje.reference = je.reference AND oje.category IN ?
+				AND op.account_id = p.account_id AND op.amount < 0 AND oje.time_stamp >= ?
+			LIMIT 1
+		) reversed ON TRUE
+		WHERE p.account_id = ? AND je.time_stamp >= ?`,
+		OutgoingCategories, ReversalCategories, OutgoingCategories, OutgoingCategories, since, accountId, since,
+	).Scan(&u).Error
+	return u, err
+}
+
+func remaining(limit int64, used int64) *int64 {
+	if limit == 0 {
+		return nil
+	}
+
+	left := limit - used
+	if left < 0 {
+		left = 0
+	}
+	return &left
+}
@@ -0,0 +1,215 @@
+// Package loginguard slows down password guessing.
+//
+// Failed logins are counted per username and per client IP. Once a counter
+// passes its policy's threshold, further attempts on that key are refused
+// for a lockout that doubles with every extra failure, up to a cap. Attempt
+// counts a login before the password is checked, so parallel guesses cannot
+// all slip in under the threshold. A successful login clears the username
+// counter and gives back its IP attempt; otherwise the IP counter only
+// decays.
+package loginguard
+
+import (
+	"errors"
+	model "final-project/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Policy controls when a counter locks and for how long.
+type Policy struct {
+	Threshold int
+	Base      time.Duration
+	Max       time.Duration
+	// Window is how long after the last failure the counter starts over.
+	Window time.Duration
+}
+
+var (
+	AccountPolicy = Policy{Threshold: 5, Base: time.Minute, Max: 24 * time.Hour, Window: 24 * time.Hour}
+	IPPolicy      = Policy{Threshold: 20, Base: time.Minute, Max: time.Hour, Window: 15 * time.Minute}
+)
+
+// Reasons recorded on login_attempt.
+const (
+	ReasonSuccess       = "success"
+	ReasonUnknownUser   = "unknown_user"
+	ReasonWrongPassword = "wrong_password"
+	ReasonThrottled     = "throttled"
+	ReasonLocked        = "locked"
+	// The password was right and the login is waiting for a second factor.
+	ReasonTwoFactorPending = "two_factor_pending"
+	ReasonWrongCode        = "wrong_code"
+)
+
+func UserKey(username string) string {
+	return "user:" + strings.ToLower(username)
+}
+
+func IPKey(ip string) string {
+	return "ip:" + ip
+}
+
+// EnrollKey counts wrong codes while an account confirms a two-factor
+// enrollment.
+func EnrollKey(accountId int64) string {
+	return "enroll:" + strconv.FormatInt(accountId, 10)
+}
+
+// Lockout returns how long the username or IP is still locked out, or zero
+// when the attempt may go ahead.
+func Lockout(db *gorm.DB, username, ip string) (time.Duration, error) {
+	var throttles []model.LoginThrottle
+	if err := db.Where("key IN ?", []string{UserKey(username), IPKey(ip)}).Find(&throttles).Error; err != nil {
+		return 0, err
+	}
+
+	var wait time.Duration
+	now := time.Now()
+	for _, t := range throttles {
+		if t.Locked_Until != nil && t.Locked_Until.After(now) {
+			if d := t.Locked_Until.Sub(now); d > wait {
+				wait = d
+			}
+		}
+	}
+	return wait, nil
+}
+
+// errLocked rolls back Attempt when either key is locked, so a refused
+// attempt is not counted.
+var errLocked = errors.New("login throttled")
+
+// Attempt counts a login attempt against both the username and the IP before
+// the credentials are checked, and returns how long the caller must wait when
+// either is locked out. A refused attempt is not counted. Callers report a
+// successful login with Success.
+func Attempt(db *gorm.DB, username, ip string) (time.Duration, error) {
+	var wait time.Duration
+	err := db.Transaction(func(tx *gorm.DB) error {
+		userWait, err := fail(tx, UserKey(username), AccountPolicy)
+		if err != nil {
+			return err
+		}
+		ipWait, err := fail(tx, IPKey(ip), IPPolicy)
+		if err != nil {
+			return err
+		}
+
+		wait = max(userWait, ipWait)
+		if wait > 0 {
+			return errLocked
+		}
+		return nil
+	})
+	if err == errLocked {
+		return wait, nil
+	}
+	return wait, err
+}
+
+// AttemptKey counts an attempt against a single key before it is checked,
+// like Attempt, and returns how long the caller must wait when the key is
+// locked out. Callers clear the key with Reset once the attempt succeeds.
+func AttemptKey(db *gorm.DB, key string, policy Policy) (time.Duration, error) {
+	var wait time.Duration
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		wait, err = fail(tx, key, policy)
+		return err
+	})
+	return wait, err
+}
+
+// Failure counts a failed attempt against both the username and the IP.
+func Failure(db *gorm.DB, username, ip string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if _, err := fail(tx, UserKey(username), AccountPolicy); err != nil {
+			return err
+		}
+		_, err := fail(tx, IPKey(ip), IPPolicy)
+		return err
+	})
+}
+
+// Success clears the username counter and takes back the IP attempt counted
+// by Attempt.
+func Success(db *gorm.DB, username, ip string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := Reset(tx, UserKey(username)); err != nil {
+			return err
+		}
+		return tx.Exec(`
+			UPDATE login_throttle SET
+				failures = GREATEST(failures - 1, 0),
+				locked_until = CASE WHEN failures - 1 < ? THEN NULL ELSE locked_until END
+			WHERE key = ?`,
+			IPPolicy.Threshold, IPKey(ip),
+		).Error
+	})
+}
+
+// Reset removes a counter and any lockout on it.
+func Reset(db *gorm.DB, key string) error {
+	return db.Where("key = ?", key).Delete(&model.LoginThrottle{}).Error
+}
+
+// Record appends an attempt to login_attempt.
+func Record(db *gorm.DB, attempt model.LoginAttempt) error {
+	attempt.Time_Stamp = time.Now()
+	return db.Create(&attempt).Error
+}
+
+// fail counts one failure on key in a single upsert, so concurrent failures
+// cannot overwrite each other, and locks the key once it reaches the
+// threshold. A key that is still locked is not counted again; its remaining
+// lockout is returned instead.
+func fail(tx *gorm.DB, key string, policy Policy) (time.Duration, error) {
+	now := time.Now()
+
+	var throttle model.LoginThrottle
+	err := tx.Raw(`
+		INSERT INTO login_throttle (key, failures, updated_at) VALUES (?, 1, ?)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE
+				WHEN login_throttle.locked_until > EXCLUDED.updated_at THEN login_throttle.failures
+				WHEN login_throttle.updated_at < ? THEN 1
+				ELSE login_throttle.failures + 1
+			END,
+			updated_at = CASE
+				WHEN login_throttle.locked_until > EXCLUDED.updated_at THEN login_throttle.updated_at
+				ELSE EXCLUDED.updated_at
+			END
+		RETURNING key, failures, locked_until, updated_at`,
+		key, now, now.Add(-policy.Window),
+	).Scan(&throttle).Error
+	if err != nil {
+		return 0, err
+	}
+
+	if throttle.Locked_Until != nil && throttle.Locked_Until.After(now) {
+		return throttle.Locked_Until.Sub(now), nil
+	}
+
+	if throttle.Failures >= policy.Threshold {
+		until := now.Add(policy.lockout(throttle.Failures))
+		if err := tx.Model(&throttle).Update("locked_until", until).Error; err != nil {
+			return 0, err
+		}
+	}
+	return 0, nil
+}
+
+func (p Policy) lockout(failures int) time.Duration {
+	d := p.Base
+	for i := p.Threshold; i < failures && d < p.Max; i++ {
+		d *= 2
+	}
+	if d > p.Max {
+		d = p.Max
+	}
+	return d
+}
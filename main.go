@@ -1,17 +1,25 @@
 package main
 
 import (
+	"context"
 	"final-project/database"
+	"final-project/deposit"
 	"final-project/handlers"
+	"final-project/httpclient"
 	"final-project/middleware"
+	model "final-project/models"
+	"final-project/outbox"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	"gorm.io/gorm"
 )
 
 type Config struct {
@@ -31,11 +39,77 @@ func getDefaultConfig() Config {
 			"Accept",
 			"Authorization",
 			"X-Requested-With",
+			middleware.IdempotencyHeader,
+			middleware.RequestIdHeader,
 		},
 		MaxAge: 12 * time.Hour,
 	}
 }
 
+// newDepositService picks the deposito engine from DEPOSIT_ENGINE. Without it,
+// the external service is used when SERVER_API is set and the built-in engine
+// otherwise.
+func newDepositService(db *gorm.DB) deposit.Service {
+	server := os.Getenv("SERVER_API")
+	engine := os.Getenv("DEPOSIT_ENGINE")
+	if engine == "" {
+		engine = "local"
+		if server != "" {
+			engine = "remote"
+		}
+	}
+
+	switch engine {
+	case "remote":
+		if server == "" {
+			log.Fatal("SERVER_API must be set when DEPOSIT_ENGINE is remote")
+		}
+		log.Printf("Deposit engine: remote (%s)", server)
+		return deposit.NewRemote(server, httpclient.New(httpclient.DefaultOptions()))
+	case "local":
+		log.Printf("Deposit engine: local")
+		return deposit.NewLocal(db)
+	default:
+		log.Fatalf("Unknown DEPOSIT_ENGINE %q", engine)
+		return nil
+	}
+}
+
+// Defaults used when TOPUP_APPROVAL_THRESHOLD and WITHDRAWAL_MAX_AMOUNT are
+// unset.
+const (
+	defaultTopUpApprovalThreshold = 10_000_000
+	defaultWithdrawalMaxAmount    = 25_000_000
+)
+
+// envAmount reads a non-negative amount from the environment, falling back
+// to def when the variable is unset. Zero turns the check it controls off.
+func envAmount(name string, def int64) int64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+
+	amount, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || amount < 0 {
+		log.Fatalf("Invalid %s %q", name, value)
+	}
+	return amount
+}
+
+// trustedProxies reads the comma separated TRUSTED_PROXIES list. Only these
+// proxies may set the client IP through X-Forwarded-For; by default none are
+// trusted and the connection's address is used.
+func trustedProxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
+
 func main() {
 	if err := godotenv.Load(); err != nil {
 		log.Printf("Warning: Error loading .env file: %v", err)
@@ -48,23 +122,40 @@ func main() {
 	}
 	defer sqlDB.Close()
 
+	if len(os.Args) > 1 {
+		runCommand(db, os.Args[1:])
+		return
+	}
+
 	jwtKey := os.Getenv("JWT_KEY_SESSION")
 	if jwtKey == "" {
 		log.Fatal("JWT key environment variable is not set")
 	}
 
+	depositService := newDepositService(db)
+	relay := outbox.NewRelay(db, depositService, 30*time.Second)
+	go relay.Start(context.Background())
+	go deposit.NewScheduler(db, time.Hour).Start(context.Background())
+
+	authJWT := middleware.AuthJWTMiddleware(db, jwtKey)
+	idempotency := middleware.Idempotency(db)
+
 	r := gin.Default()
+	if err := r.SetTrustedProxies(trustedProxies()); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
 
 	corsConfig := cors.Config{
 		AllowOrigins:     getDefaultConfig().AllowedOrigins,
 		AllowMethods:     getDefaultConfig().AllowedMethods,
 		AllowHeaders:     getDefaultConfig().AllowedHeaders,
-		ExposeHeaders:    []string{"Content-Length"},
+		ExposeHeaders:    []string{"Content-Length", middleware.RequestIdHeader},
 		AllowCredentials: true,
 		MaxAge:           getDefaultConfig().MaxAge,
 	}
 
 	r.Use(cors.New(corsConfig))
+	r.Use(middleware.RequestID())
 	v1 := r.Group("/v1")
 	{
 		v1.GET("/health", func(ctx *gin.Context) {
@@ -85,26 +176,86 @@ func main() {
 		{
 			accountRoutes.POST("/login/admin", accountHandler.AccountAdminLogin) // Restricted to admin login
 			accountRoutes.POST("/login/user", accountHandler.AccountUserLogin)
-			accountRoutes.POST("/signup/admin", accountHandler.AccountAdminSignup)
+			accountRoutes.POST("/login/2fa", accountHandler.LoginTwoFactor)
+			accountRoutes.POST("/invitation/accept", accountHandler.AcceptAdminInvitation)
 			accountRoutes.POST("/signup/user", accountHandler.AccountUserSignup)
-			accountRoutes.POST("/change-password", middleware.AuthJWTMiddleware(jwtKey), accountHandler.ChangePassword)
+			accountRoutes.POST("/change-password", authJWT, accountHandler.ChangePassword)
+			accountRoutes.POST("/refresh", accountHandler.RefreshToken)
+			accountRoutes.POST("/logout", authJWT, accountHandler.Logout)
+			accountRoutes.POST("/2fa/enroll", authJWT, accountHandler.EnrollTwoFactor)
+			accountRoutes.POST("/2fa/confirm", authJWT, accountHandler.ConfirmTwoFactor)
+			accountRoutes.POST("/2fa/disable", authJWT, accountHandler.DisableTwoFactor)
+			accountRoutes.POST("/2fa/recovery-codes", authJWT, accountHandler.RegenerateRecoveryCodes)
 		}
-		userHandler := handlers.NewUser(db)
+		userHandler := handlers.NewUser(db, depositService, relay)
+		limitHandler := handlers.NewLimit(db)
+		withdrawalHandler := handlers.NewWithdrawal(db, envAmount("WITHDRAWAL_MAX_AMOUNT", defaultWithdrawalMaxAmount))
 		userRoutes := v1.Group("/user")
 		{
-			userRoutes.GET("/profile", middleware.AuthJWTMiddleware(jwtKey), userHandler.Profile)
-			userRoutes.GET("/mutation/transaction", middleware.AuthJWTMiddleware(jwtKey), userHandler.TransactionHistory)
-			userRoutes.GET("/mutation/deposit", middleware.AuthJWTMiddleware(jwtKey), userHandler.PersonalDeposit)
-			userRoutes.POST("/edit/profile", middleware.AuthJWTMiddleware(jwtKey), userHandler.EditProfile)
-			userRoutes.POST("/register/deposit", middleware.AuthJWTMiddleware(jwtKey), userHandler.RegisterDeposit)
+			userRoutes.GET("/profile", authJWT, userHandler.Profile)
+			userRoutes.GET("/mutation/transaction", authJWT, userHandler.TransactionHistory)
+			userRoutes.GET("/mutation/deposit", authJWT, userHandler.PersonalDeposit)
+			userRoutes.POST("/edit/profile", authJWT, userHandler.EditProfile)
+			userRoutes.POST("/register/deposit", authJWT, idempotency, userHandler.RegisterDeposit)
+			userRoutes.POST("/transfer", authJWT, idempotency, userHandler.Transfer)
+			userRoutes.GET("/deposit/:id/withdraw", authJWT, userHandler.QuoteWithdrawDeposit)
+			userRoutes.POST("/deposit/:id/withdraw", authJWT, idempotency, userHandler.WithdrawDeposit)
+			userRoutes.PUT("/deposit/:id/rollover", authJWT, userHandler.UpdateDepositRollover)
+			userRoutes.GET("/withdraw", authJWT, withdrawalHandler.PersonalWithdrawal)
+			userRoutes.GET("/limits", authJWT, limitHandler.PersonalLimit)
+			userRoutes.POST("/withdraw", authJWT, idempotency, withdrawalHandler.Withdraw)
 		}
-		adminHandler := handlers.NewAdmin(db)
-		adminRoutes := v1.Group("/admin")
+		productHandler := handlers.NewProduct(db)
+		depositRoutes := v1.Group("/deposit")
 		{
-			adminRoutes.GET("/list/user", middleware.AuthJWTMiddleware(jwtKey), adminHandler.ListUserProfile)
-			adminRoutes.GET("/list/user/:id", middleware.AuthJWTMiddleware(jwtKey), adminHandler.DetailUser)
-			adminRoutes.GET("/list/deposit/mutation", middleware.AuthJWTMiddleware(jwtKey), adminHandler.ListUserDeposito)
-			adminRoutes.POST("/topup", middleware.AuthJWTMiddleware(jwtKey), adminHandler.TopUpUser)
+			depositRoutes.GET("/products", productHandler.ListActiveProduct)
+			depositRoutes.POST("/simulate", productHandler.Simulate)
+		}
+		adminHandler := handlers.NewAdmin(db, envAmount("TOPUP_APPROVAL_THRESHOLD", defaultTopUpApprovalThreshold))
+		auditHandler := handlers.NewAudit(db)
+		securityHandler := handlers.NewSecurity(db)
+		adminRoutes := v1.Group("/admin", authJWT, middleware.Audit(db), middleware.RequireRole(model.RoleAdmin), middleware.RequireTwoFactor())
+		{
+			canReadUser := middleware.RequirePermission(db, model.PermissionUserRead)
+			canTopUp := middleware.RequirePermission(db, model.PermissionUserTopUp)
+			canApproveTopUp := middleware.RequirePermission(db, model.PermissionTopUpApprove)
+			canReadTopUp := middleware.RequirePermission(db, model.PermissionUserTopUp, model.PermissionTopUpApprove)
+			canReadDeposit := middleware.RequirePermission(db, model.PermissionDepositRead)
+			canManageDeposit := middleware.RequirePermission(db, model.PermissionDepositManage)
+			canWithdraw := middleware.RequirePermission(db, model.PermissionUserWithdraw)
+			canManageLimit := middleware.RequirePermission(db, model.PermissionUserLimit)
+			canUnlock := middleware.RequirePermission(db, model.PermissionAccountUnlock)
+			canManageAdmin := middleware.RequirePermission(db, model.PermissionAdminManage)
+			canReadAudit := middleware.RequirePermission(db, model.PermissionAuditRead)
+
+			adminRoutes.GET("/list/user", canReadUser, adminHandler.ListUserProfile)
+			adminRoutes.GET("/list/user/:id", canReadUser, adminHandler.DetailUser)
+			adminRoutes.GET("/list/deposit/mutation", canReadDeposit, adminHandler.ListUserDeposito)
+			adminRoutes.POST("/topup", canTopUp, idempotency, adminHandler.TopUpUser)
+			adminRoutes.GET("/topup/requests", canReadTopUp, adminHandler.ListTopUpRequest)
+			adminRoutes.POST("/topup/requests/:id/approve", canApproveTopUp, adminHandler.ApproveTopUpRequest)
+			adminRoutes.POST("/topup/requests/:id/reject", canApproveTopUp, adminHandler.RejectTopUpRequest)
+			adminRoutes.GET("/ledger/:id", canReadUser, adminHandler.LedgerAccount)
+			adminRoutes.PUT("/list/user/:id/tier", canManageLimit, limitHandler.UpdateUserTier)
+			adminRoutes.GET("/tiers", canReadUser, limitHandler.ListTier)
+			adminRoutes.PUT("/tiers/:code", canManageLimit, limitHandler.UpdateTier)
+			adminRoutes.POST("/withdraw", canWithdraw, idempotency, withdrawalHandler.TellerWithdraw)
+			adminRoutes.GET("/withdrawals", canWithdraw, withdrawalHandler.ListWithdrawal)
+			adminRoutes.POST("/withdrawals/:id/complete", canWithdraw, withdrawalHandler.CompleteWithdrawal)
+			adminRoutes.POST("/withdrawals/:id/fail", canWithdraw, withdrawalHandler.FailWithdrawal)
+			adminRoutes.GET("/deposit/products", canReadDeposit, productHandler.ListProduct)
+			adminRoutes.POST("/deposit/products", canManageDeposit, productHandler.CreateProduct)
+			adminRoutes.PUT("/deposit/products/:id", canManageDeposit, productHandler.UpdateProduct)
+			adminRoutes.DELETE("/deposit/products/:id", canManageDeposit, productHandler.RetireProduct)
+			adminRoutes.GET("/invitations", canManageAdmin, adminHandler.ListInvitation)
+			adminRoutes.POST("/invitations", canManageAdmin, adminHandler.CreateInvitation)
+			adminRoutes.GET("/roles", canManageAdmin, adminHandler.ListRolePermission)
+			adminRoutes.PUT("/roles/:position", canManageAdmin, adminHandler.UpdateRolePermission)
+			adminRoutes.PUT("/admins/:id", canManageAdmin, adminHandler.UpdateAdminPosition)
+			adminRoutes.GET("/audit", canReadAudit, auditHandler.ListAuditLog)
+			adminRoutes.GET("/login/attempts", canReadAudit, securityHandler.ListLoginAttempt)
+			adminRoutes.POST("/accounts/:id/unlock", canUnlock, securityHandler.UnlockAccount)
+			adminRoutes.POST("/login/unlock-ip", canUnlock, securityHandler.UnlockIP)
 		}
 
 	}
@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"final-project/audit"
+	"log"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Audit writes an admin_audit_log entry for every request that passes
+// through it, including the ones later middleware reject, such as a user
+// token refused by RequireRole. It must run after AuthJWTMiddleware so the
+// actor is known.
+func Audit(db *gorm.DB) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		audit.Begin(ctx)
+		ctx.Next()
+
+		if err := audit.Write(db, ctx); err != nil {
+			log.Printf("audit: %v", err)
+		}
+	}
+}
@@ -1,13 +1,16 @@
 package middleware
 
 import (
+	model "final-project/models"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
 )
 
-func AuthJWTMiddleware(secretKey string) gin.HandlerFunc {
+func AuthJWTMiddleware(db *gorm.DB, secretKey string) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		tokenString := ctx.GetHeader("Authorization")
 
@@ -33,6 +36,12 @@ func AuthJWTMiddleware(secretKey string) gin.HandlerFunc {
 			if username, ok := claims["username"].(string); ok {
 				ctx.Set("username", username)
 			}
+			if role, ok := claims["role"].(float64); ok {
+				ctx.Set("role", int(role))
+			}
+			if sessionId, ok := claims["sid"].(string); ok {
+				ctx.Set("session_id", sessionId)
+			}
 		} else {
 			ctx.JSON(http.StatusUnauthorized, gin.H{
 				"error": "Unauthorized",
@@ -41,6 +50,18 @@ func AuthJWTMiddleware(secretKey string) gin.HandlerFunc {
 			return
 		}
 
+		// Tokens stay valid only as long as their session has not been
+		// revoked by a logout or a refresh token reuse.
+		var session model.Session
+		if err := db.Where("id = ? AND revoked_at IS NULL AND expires_at > ?", ctx.GetString("session_id"), time.Now()).First(&session).Error; err != nil {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"error": "Unauthorized",
+			})
+			ctx.Abort()
+			return
+		}
+		ctx.Set("two_factor", session.Two_Factor)
+
 		ctx.Next()
 	}
 }
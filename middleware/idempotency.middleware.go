@@ -0,0 +1,159 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	model "final-project/models"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const IdempotencyHeader = "Idempotency-Key"
+
+// idempotencyAbandonAfter is how long a key may stay in progress before a
+// retry takes it over. Rows are only left in progress when the process died
+// mid-request.
+const idempotencyAbandonAfter = 2 * time.Minute
+
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Idempotency makes a money-moving route safe to retry. The first request with
+// a given Idempotency-Key is executed and its response stored; a replay with
+// the same key and body gets the stored response back, and a replay with the
+// same key but a different body is rejected with 409. A key left in progress
+// by a request that never finished is taken over after
+// idempotencyAbandonAfter. Requests without the
+// header are passed through unchanged. It must run after AuthJWTMiddleware
+// because keys are scoped to the caller.
+func Idempotency(db *gorm.DB) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		key := ctx.GetHeader(IdempotencyHeader)
+		if key == "" {
+			ctx.Next()
+			return
+		}
+
+		body, err := io.ReadAll(ctx.Request.Body)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		ctx.Request.Body = io.NopCloser(bytes.NewBuffer(body))
+
+		hash := sha256.New()
+		hash.Write([]byte(ctx.Request.Method + " " + ctx.Request.URL.Path + "\n"))
+		hash.Write(body)
+
+		record := model.IdempotencyKey{
+			Account_Id:   ctx.GetInt64("id"),
+			Route:        ctx.FullPath(),
+			Key:          key,
+			Request_Hash: hex.EncodeToString(hash.Sum(nil)),
+			Time_Stamp:   time.Now(),
+		}
+
+		result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&record)
+		if result.Error != nil {
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error": result.Error.Error(),
+			})
+			return
+		}
+
+		if result.RowsAffected == 0 {
+			stored := model.IdempotencyKey{}
+			if err := db.Where("account_id = ? AND route = ? AND key = ?", record.Account_Id, record.Route, key).First(&stored).Error; err != nil {
+				ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+					"error": err.Error(),
+				})
+				return
+			}
+
+			if stored.Request_Hash != record.Request_Hash {
+				ctx.AbortWithStatusJSON(http.StatusConflict, gin.H{
+					"error": "idempotency key already used with a different request",
+				})
+				return
+			}
+
+			if stored.Status_Code == 0 {
+				claimed := db.Model(&stored).
+					Where("status_code = 0 AND time_stamp < ?", time.Now().Add(-idempotencyAbandonAfter)).
+					Update("time_stamp", time.Now())
+				if claimed.Error != nil {
+					ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+						"error": claimed.Error.Error(),
+					})
+					return
+				}
+				if claimed.RowsAffected == 0 {
+					ctx.AbortWithStatusJSON(http.StatusConflict, gin.H{
+						"error": "a request with this idempotency key is still in progress",
+					})
+					return
+				}
+				record = stored
+			} else {
+				ctx.Header("Idempotent-Replayed", "true")
+				ctx.Data(stored.Status_Code, "application/json; charset=utf-8", []byte(stored.Response_Body))
+				ctx.Abort()
+				return
+			}
+		}
+
+		recorder := &responseRecorder{ResponseWriter: ctx.Writer}
+		ctx.Writer = recorder
+
+		// A panicking handler releases the key so a retry is not stuck
+		// behind a request that will never finish.
+		defer func() {
+			if p := recover(); p != nil {
+				if err := db.Delete(&record).Error; err != nil {
+					log.Printf("idempotency: release key %d: %v", record.Id, err)
+				}
+				panic(p)
+			}
+		}()
+
+		ctx.Next()
+
+		// Server errors are not stored so the client can retry them with the
+		// same key once the problem is gone.
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError {
+			if err := db.Delete(&record).Error; err != nil {
+				log.Printf("idempotency: release key %d: %v", record.Id, err)
+			}
+			return
+		}
+
+		if err := db.Model(&record).Updates(map[string]interface{}{
+			"status_code":   status,
+			"response_body": recorder.body.String(),
+		}).Error; err != nil {
+			log.Printf("idempotency: store response for key %d: %v", record.Id, err)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	model "final-project/models"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RequirePermission only lets an admin through when their position, or the
+// extra permissions granted on their admin row, include any of the given
+// actions. Grants are read from the database on every request so changes
+// apply without a restart.
+func RequirePermission(db *gorm.DB, required ...string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		permissions, err := AdminPermissions(db, ctx.GetInt64("id"))
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "Forbidden",
+			})
+			return
+		}
+
+		for _, p := range permissions {
+			for _, permission := range required {
+				if p == permission {
+					ctx.Next()
+					return
+				}
+			}
+		}
+
+		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error":      "Forbidden",
+			"permission": strings.Join(required, " or "),
+		})
+	}
+}
+
+// AdminPermissions returns every action granted to the admin behind the
+// given account.
+func AdminPermissions(db *gorm.DB, accountId int64) ([]string, error) {
+	admin := model.Admin{}
+	if err := db.Where("account_id = ?", accountId).First(&admin).Error; err != nil {
+		return nil, err
+	}
+
+	var permissions []string
+	if err := db.Model(&model.AdminRolePermission{}).
+		Where("position = ?", strings.ToLower(admin.Position)).
+		Pluck("permission", &permissions).Error; err != nil {
+		return nil, err
+	}
+
+	for _, p := range strings.Split(admin.Permissions, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			permissions = append(permissions, p)
+		}
+	}
+	return permissions, nil
+}
@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/gin-gonic/gin"
+)
+
+const RequestIdHeader = "X-Request-Id"
+
+// RequestID tags every request with an ID, reusing the caller's X-Request-Id
+// when it looks sane, and echoes it back in the response.
+func RequestID() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := ctx.GetHeader(RequestIdHeader)
+		if id == "" || len(id) > 64 {
+			buf := make([]byte, 16)
+			rand.Read(buf)
+			id = hex.EncodeToString(buf)
+		}
+
+		ctx.Set("request_id", id)
+		ctx.Header(RequestIdHeader, id)
+		ctx.Next()
+	}
+}
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireRole only lets the request through when the role claim set by
+// AuthJWTMiddleware matches one of the given roles.
+func RequireRole(roles ...int) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		role, ok := ctx.Get("role")
+		if !ok {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "Forbidden",
+			})
+			return
+		}
+
+		for _, r := range roles {
+			if role == r {
+				ctx.Next()
+				return
+			}
+		}
+
+		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": "Forbidden",
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireTwoFactor only lets the request through when its session was
+// verified with a second factor, either at login or by confirming TOTP
+// enrollment. It must run after AuthJWTMiddleware.
+func RequireTwoFactor() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !ctx.GetBool("two_factor") {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error":  "two-factor authentication required",
+				"enroll": "/v1/account/2fa/enroll",
+			})
+			return
+		}
+
+		ctx.Next()
+	}
+}
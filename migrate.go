@@ -0,0 +1,64 @@
+package main
+
+import (
+	"final-project/database"
+	"fmt"
+	"log"
+	"strconv"
+
+	"gorm.io/gorm"
+)
+
+const migrateUsage = "usage: migrate up | down [steps] | status"
+
+// runMigrate implements the migrate subcommand.
+func runMigrate(db *gorm.DB, args []string) {
+	if len(args) == 0 {
+		log.Fatal(migrateUsage)
+	}
+
+	switch args[0] {
+	case "up":
+		versions, err := database.MigrateUp(db)
+		for _, version := range versions {
+			fmt.Printf("applied %04d\n", version)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(versions) == 0 {
+			fmt.Println("no pending migrations")
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				log.Fatal(migrateUsage)
+			}
+			steps = n
+		}
+
+		versions, err := database.MigrateDown(db, steps)
+		for _, version := range versions {
+			fmt.Printf("reverted %04d\n", version)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "status":
+		status, err := database.MigrationState(db)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, migration := range status {
+			state := "pending"
+			if migration.Applied_At != nil {
+				state = "applied " + migration.Applied_At.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-24s %s\n", migration.Version, migration.Name, state)
+		}
+	default:
+		log.Fatal(migrateUsage)
+	}
+}
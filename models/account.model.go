@@ -1,10 +1,16 @@
 package model
 
+const (
+	RoleUser  = 0
+	RoleAdmin = 1
+)
+
 type Account struct {
-	Id       int64  `json:"id" gorm:"primaryKey;autoIncrement;<-:false"`
-	Username string `json:"username"`
-	Password string `json:"password"`
-	Role     int    `json:"role"`
+	Id        int64  `json:"id" gorm:"primaryKey;autoIncrement;<-:false"`
+	Username  string `json:"username"`
+	Password  string `json:"password"`
+	Role      int    `json:"role"`
+	Is_Locked bool   `json:"is_locked"`
 }
 
 func (Account) TableName() string {
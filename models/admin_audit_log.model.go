@@ -0,0 +1,28 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AdminAuditLog is one privileged admin request. Rows are never updated or
+// deleted; the table rejects both.
+type AdminAuditLog struct {
+	Id                int64           `json:"id" gorm:"primaryKey;autoIncrement;<-:false"`
+	Actor_Id          int64           `json:"actor_id"`
+	Action            string          `json:"action"`
+	Target_Account_Id *int64          `json:"target_account_id"`
+	Request_Id        string          `json:"request_id"`
+	Ip                string          `json:"ip"`
+	Method            string          `json:"method"`
+	Path              string          `json:"path"`
+	Status_Code       int             `json:"status_code"`
+	Outcome           string          `json:"outcome"`
+	Before_State      json.RawMessage `json:"before_state"`
+	After_State       json.RawMessage `json:"after_state"`
+	Time_Stamp        time.Time       `json:"time_stamp"`
+}
+
+func (AdminAuditLog) TableName() string {
+	return "admin_audit_log"
+}
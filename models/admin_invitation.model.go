@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+type AdminInvitation struct {
+	Id          int64      `json:"id" gorm:"primaryKey;autoIncrement;<-:false"`
+	Token_Hash  string     `json:"-"`
+	Invited_By  int64      `json:"invited_by"`
+	Position    string     `json:"position"`
+	Permissions string     `json:"permissions"`
+	Expires_At  time.Time  `json:"expires_at"`
+	Used_At     *time.Time `json:"used_at"`
+	Used_By     *int64     `json:"used_by"`
+	Time_Stamp  time.Time  `json:"time_stamp"`
+}
+
+func (AdminInvitation) TableName() string {
+	return "admin_invitation"
+}
@@ -0,0 +1,47 @@
+package model
+
+const (
+	PermissionUserRead      = "user.read"
+	PermissionUserTopUp     = "user.topup"
+	PermissionTopUpApprove  = "topup.approve"
+	PermissionUserWithdraw  = "user.withdraw"
+	PermissionUserLimit     = "user.limit"
+	PermissionAccountUnlock = "account.unlock"
+	PermissionDepositRead   = "deposit.read"
+	PermissionDepositManage = "deposit.manage"
+	PermissionAdminManage   = "admin.manage"
+	PermissionAuditRead     = "audit.read"
+)
+
+// Permissions lists every action an admin can be granted.
+var Permissions = []string{
+	PermissionUserRead,
+	PermissionUserTopUp,
+	PermissionTopUpApprove,
+	PermissionUserWithdraw,
+	PermissionUserLimit,
+	PermissionAccountUnlock,
+	PermissionDepositRead,
+	PermissionDepositManage,
+	PermissionAdminManage,
+	PermissionAuditRead,
+}
+
+func IsPermission(name string) bool {
+	for _, p := range Permissions {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+// AdminRolePermission maps an Admin.Position to one action it may perform.
+type AdminRolePermission struct {
+	Position   string `json:"position" gorm:"primaryKey"`
+	Permission string `json:"permission" gorm:"primaryKey"`
+}
+
+func (AdminRolePermission) TableName() string {
+	return "admin_role_permission"
+}
@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+type DepositAccrual struct {
+	Id                 int64     `json:"id" gorm:"primaryKey;autoIncrement;<-:false"`
+	Deposit_History_Id int64     `json:"deposit_history_id"`
+	Accrual_Date       time.Time `json:"accrual_date"`
+	Amount             int64     `json:"amount"`
+	Time_Stamp         time.Time `json:"time_stamp"`
+}
+
+func (DepositAccrual) TableName() string {
+	return "deposit_accrual"
+}
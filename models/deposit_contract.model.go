@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+const (
+	ContractStatusActive  = "active"
+	ContractStatusMatured = "matured"
+	ContractStatusClosed  = "closed"
+)
+
+type DepositContract struct {
+	Id            int64     `json:"id" gorm:"primaryKey;autoIncrement;<-:false"`
+	Contract_Id   string    `json:"contract_id"`
+	Reference     string    `json:"reference"`
+	Deposit_Id    string    `json:"deposit_id"`
+	Account_Id    int64     `json:"account_id"`
+	Name          string    `json:"name"`
+	Amount        int64     `json:"amount"`
+	Tenor_Months  int       `json:"tenor_months"`
+	Interest_Rate float64   `json:"interest_rate"`
+	Start_Date    time.Time `json:"start_date"`
+	Maturity_Date time.Time `json:"maturity_date"`
+	Status        string    `json:"status"`
+	Time_Stamp    time.Time `json:"time_stamp"`
+}
+
+func (DepositContract) TableName() string {
+	return "deposit_contract"
+}
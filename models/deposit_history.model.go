@@ -2,14 +2,34 @@ package model
 
 import "time"
 
+const (
+	DepositStatusReserved = "reserved"
+	DepositStatusActive   = "active"
+	DepositStatusReleased = "released"
+	DepositStatusMatured  = "matured"
+	DepositStatusClosed   = "closed"
+)
+
+const (
+	RolloverNone              = "none"
+	RolloverPrincipal         = "principal"
+	RolloverPrincipalInterest = "principal_interest"
+)
+
 type DepositHistory struct {
-	Id           int64     `json:"id" gorm:"primaryKey;autoIncrement;<-:false"`
-	Deposit_Id   string    `json:"deposit_id"`
-	Account_Id   int64     `json:"account_id"`
-	Deposit_Name string    `json:"deposit_name"`
-	Amount       int64     `json:"amount"`
-	Time_Period  int       `json:"time_period"`
-	Time_Stamp   time.Time `json:"time_stamp"`
+	Id             int64     `json:"id" gorm:"primaryKey;autoIncrement;<-:false"`
+	Deposit_Id     string    `json:"deposit_id"`
+	Contract_Id    string    `json:"contract_id"`
+	Account_Id     int64     `json:"account_id"`
+	Deposit_Name   string    `json:"deposit_name"`
+	Amount         int64     `json:"amount"`
+	Time_Period    int       `json:"time_period"`
+	Interest_Rate  float64   `json:"interest_rate"`
+	Tax_Rate       float64   `json:"tax_rate"`
+	Rollover       string    `json:"rollover"`
+	Rolled_From_Id *int64    `json:"rolled_from_id"`
+	Status         string    `json:"status"`
+	Time_Stamp     time.Time `json:"time_stamp"`
 }
 
 func (DepositHistory) TableName() string {
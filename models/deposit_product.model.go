@@ -0,0 +1,65 @@
+package model
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type DepositProduct struct {
+	Id                       int64     `json:"id" gorm:"primaryKey;autoIncrement;<-:false"`
+	Code                     string    `json:"code"`
+	Name                     string    `json:"name"`
+	Min_Amount               int64     `json:"min_amount"`
+	Max_Amount               int64     `json:"max_amount"`
+	Tenors                   string    `json:"-"`
+	Interest_Rate            float64   `json:"interest_rate"`
+	Early_Withdrawal_Penalty float64   `json:"early_withdrawal_penalty"`
+	Tax_Rate                 float64   `json:"tax_rate"`
+	Is_Active                bool      `json:"is_active"`
+	Time_Stamp               time.Time `json:"time_stamp"`
+}
+
+func (DepositProduct) TableName() string {
+	return "deposit_product"
+}
+
+// MarshalJSON exposes Tenors as an array of months, the same shape
+// ProductPayload accepts; the comma separated string is only for storage.
+func (p DepositProduct) MarshalJSON() ([]byte, error) {
+	type product DepositProduct
+	tenors := p.TenorList()
+	if tenors == nil {
+		tenors = []int{}
+	}
+	return json.Marshal(struct {
+		product
+		Tenors []int `json:"tenors"`
+	}{product(p), tenors})
+}
+
+// TenorList parses Tenors, a comma separated list of allowed tenors in months.
+func (p DepositProduct) TenorList() []int {
+	var tenors []int
+	for _, part := range strings.Split(p.Tenors, ",") {
+		month, err := strconv.Atoi(strings.TrimSpace(part))
+		if err == nil && month > 0 {
+			tenors = append(tenors, month)
+		}
+	}
+	return tenors
+}
+
+func (p DepositProduct) AllowsAmount(amount int64) bool {
+	return amount >= p.Min_Amount && amount <= p.Max_Amount
+}
+
+func (p DepositProduct) AllowsTenor(month int) bool {
+	for _, tenor := range p.TenorList() {
+		if tenor == month {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+type IdempotencyKey struct {
+	Id            int64     `json:"id" gorm:"primaryKey;autoIncrement;<-:false"`
+	Account_Id    int64     `json:"account_id"`
+	Route         string    `json:"route"`
+	Key           string    `json:"key"`
+	Request_Hash  string    `json:"request_hash"`
+	Status_Code   int       `json:"status_code"`
+	Response_Body string    `json:"response_body"`
+	Time_Stamp    time.Time `json:"time_stamp"`
+}
+
+func (IdempotencyKey) TableName() string {
+	return "idempotency_key"
+}
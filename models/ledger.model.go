@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+type JournalEntry struct {
+	Id         int64     `json:"id" gorm:"primaryKey;autoIncrement;<-:false"`
+	Category   string    `json:"category"`
+	Reference  string    `json:"reference"`
+	Time_Stamp time.Time `json:"time_stamp"`
+}
+
+func (JournalEntry) TableName() string {
+	return "journal_entry"
+}
+
+type Posting struct {
+	Id               int64  `json:"id" gorm:"primaryKey;autoIncrement;<-:false"`
+	Journal_Entry_Id int64  `json:"journal_entry_id"`
+	Ledger_Account   string `json:"ledger_account"`
+	Account_Id       *int64 `json:"account_id"`
+	Amount           int64  `json:"amount"`
+}
+
+func (Posting) TableName() string {
+	return "posting"
+}
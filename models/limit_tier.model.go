@@ -0,0 +1,19 @@
+package model
+
+const DefaultTier = "basic"
+
+// LimitTier caps how much a user on the tier can move out of their wallet.
+// A zero limit is not enforced.
+type LimitTier struct {
+	Code           string `json:"code" gorm:"primaryKey"`
+	Name           string `json:"name"`
+	Single_Max     int64  `json:"single_max"`
+	Daily_Amount   int64  `json:"daily_amount"`
+	Daily_Count    int64  `json:"daily_count"`
+	Monthly_Amount int64  `json:"monthly_amount"`
+	Monthly_Count  int64  `json:"monthly_count"`
+}
+
+func (LimitTier) TableName() string {
+	return "limit_tier"
+}
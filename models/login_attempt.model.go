@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+type LoginAttempt struct {
+	Id         int64     `json:"id" gorm:"primaryKey;autoIncrement;<-:false"`
+	Username   string    `json:"username"`
+	Account_Id *int64    `json:"account_id"`
+	Ip         string    `json:"ip"`
+	Role       int       `json:"role"`
+	Success    bool      `json:"success"`
+	Reason     string    `json:"reason"`
+	Time_Stamp time.Time `json:"time_stamp"`
+}
+
+func (LoginAttempt) TableName() string {
+	return "login_attempt"
+}
+
+type LoginThrottle struct {
+	Key          string     `json:"key" gorm:"primaryKey"`
+	Failures     int        `json:"failures"`
+	Locked_Until *time.Time `json:"locked_until"`
+	Updated_At   time.Time  `json:"updated_at"`
+}
+
+func (LoginThrottle) TableName() string {
+	return "login_throttle"
+}
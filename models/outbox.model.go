@@ -0,0 +1,28 @@
+package model
+
+import "time"
+
+const (
+	OutboxStatusPending = "pending"
+	OutboxStatusSending = "sending"
+	OutboxStatusSent    = "sent"
+	OutboxStatusFailed  = "failed"
+)
+
+type Outbox struct {
+	Id              int64      `json:"id" gorm:"primaryKey;autoIncrement;<-:false"`
+	Event_Type      string     `json:"event_type"`
+	Aggregate_Id    int64      `json:"aggregate_id"`
+	Dedup_Key       string     `json:"dedup_key"`
+	Payload         string     `json:"payload"`
+	Status          string     `json:"status"`
+	Attempts        int        `json:"attempts"`
+	Last_Error      string     `json:"last_error"`
+	Next_Attempt_At time.Time  `json:"next_attempt_at"`
+	Sent_At         *time.Time `json:"sent_at"`
+	Time_Stamp      time.Time  `json:"time_stamp"`
+}
+
+func (Outbox) TableName() string {
+	return "outbox"
+}
@@ -1,11 +1,15 @@
 package model
 
+import "time"
+
 type Deposit struct {
-	ContractID string  `json:"contract_id"`
-	DepositoID string  `json:"deposito_id"`
-	Name       string  `json:"name"`
-	AccountID  string  `json:"account_id"`
-	MinMonth   int     `json:"min_month"`
-	Amount     int     `json:"amount"`
-	Bonus      float64 `json:"bonus"`
+	ContractID   string     `json:"contract_id"`
+	DepositoID   string     `json:"deposito_id"`
+	Name         string     `json:"name"`
+	AccountID    string     `json:"account_id"`
+	MinMonth     int        `json:"min_month"`
+	Amount       int        `json:"amount"`
+	Bonus        float64    `json:"bonus"`
+	MaturityDate *time.Time `json:"maturity_date,omitempty"`
+	Status       string     `json:"status,omitempty"`
 }
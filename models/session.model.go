@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+type Session struct {
+	Id         string     `json:"id" gorm:"primaryKey"`
+	Account_Id int64      `json:"account_id"`
+	Expires_At time.Time  `json:"expires_at"`
+	Revoked_At *time.Time `json:"revoked_at"`
+	Two_Factor bool       `json:"two_factor"`
+	Time_Stamp time.Time  `json:"time_stamp"`
+}
+
+func (Session) TableName() string {
+	return "session"
+}
+
+type RefreshToken struct {
+	Id         int64      `json:"id" gorm:"primaryKey;autoIncrement;<-:false"`
+	Session_Id string     `json:"session_id"`
+	Token_Hash string     `json:"-"`
+	Expires_At time.Time  `json:"expires_at"`
+	Used_At    *time.Time `json:"used_at"`
+	Time_Stamp time.Time  `json:"time_stamp"`
+}
+
+func (RefreshToken) TableName() string {
+	return "refresh_token"
+}
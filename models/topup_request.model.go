@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+const (
+	TopUpRequestPending  = "pending"
+	TopUpRequestApproved = "approved"
+	TopUpRequestRejected = "rejected"
+)
+
+// TopUpRequest is a top-up above the approval threshold waiting for a second
+// admin. Nothing is credited until it is approved.
+type TopUpRequest struct {
+	Id                     int64      `json:"id" gorm:"primaryKey;autoIncrement;<-:false"`
+	Account_Id             int64      `json:"account_id"`
+	Amount                 int64      `json:"amount"`
+	Status                 string     `json:"status"`
+	Maker_Id               int64      `json:"maker_id"`
+	Maker_Reason           string     `json:"maker_reason"`
+	Checker_Id             *int64     `json:"checker_id"`
+	Checker_Reason         string     `json:"checker_reason"`
+	Transaction_History_Id *int64     `json:"transaction_history_id"`
+	Time_Stamp             time.Time  `json:"time_stamp"`
+	Decided_At             *time.Time `json:"decided_at"`
+}
+
+func (TopUpRequest) TableName() string {
+	return "topup_request"
+}
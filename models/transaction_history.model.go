@@ -8,6 +8,8 @@ type TransactionHistory struct {
 	Transaction_Category string    `json:"transaction_category"`
 	Amount               int64     `json:"amount"`
 	In_Out               int       `json:"in_out"`
+	Reference            string    `json:"reference"`
+	Maker_Id             *int64    `json:"-"`
 	Time_Stamp           time.Time `json:"time_stamp"`
 }
 
@@ -0,0 +1,43 @@
+package model
+
+import "time"
+
+// TwoFactor holds an account's TOTP secret. It only protects logins once
+// Enabled is set by confirming a first code.
+type TwoFactor struct {
+	Account_Id     int64      `json:"account_id" gorm:"primaryKey"`
+	Secret         string     `json:"-"`
+	Enabled        bool       `json:"enabled"`
+	Last_Used_Step int64      `json:"-"`
+	Confirmed_At   *time.Time `json:"confirmed_at"`
+	Time_Stamp     time.Time  `json:"time_stamp"`
+}
+
+func (TwoFactor) TableName() string {
+	return "two_factor"
+}
+
+type RecoveryCode struct {
+	Id         int64      `json:"id" gorm:"primaryKey;autoIncrement;<-:false"`
+	Account_Id int64      `json:"account_id"`
+	Code_Hash  string     `json:"-"`
+	Used_At    *time.Time `json:"used_at"`
+	Time_Stamp time.Time  `json:"time_stamp"`
+}
+
+func (RecoveryCode) TableName() string {
+	return "recovery_code"
+}
+
+type LoginChallenge struct {
+	Token_Hash string     `json:"-" gorm:"primaryKey"`
+	Account_Id int64      `json:"account_id"`
+	Attempts   int        `json:"attempts"`
+	Expires_At time.Time  `json:"expires_at"`
+	Used_At    *time.Time `json:"used_at"`
+	Time_Stamp time.Time  `json:"time_stamp"`
+}
+
+func (LoginChallenge) TableName() string {
+	return "login_challenge"
+}
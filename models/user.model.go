@@ -13,6 +13,7 @@ type User struct {
 	Date_of_Birth  time.Time `json:"date_of_birth"`
 	Gender         string    `json:"gender"`
 	Balance        int64     `json:"balance"`
+	Tier           string    `json:"tier" gorm:"default:basic"`
 }
 
 func (User) TableName() string {
@@ -0,0 +1,34 @@
+package model
+
+import "time"
+
+const (
+	WithdrawalPending   = "pending"
+	WithdrawalCompleted = "completed"
+	WithdrawalFailed    = "failed"
+)
+
+const (
+	WithdrawalChannelUser   = "user"
+	WithdrawalChannelTeller = "teller"
+)
+
+type Withdrawal struct {
+	Id                     int64      `json:"id" gorm:"primaryKey;autoIncrement;<-:false"`
+	Account_Id             int64      `json:"account_id"`
+	Amount                 int64      `json:"amount"`
+	Status                 string     `json:"status"`
+	Channel                string     `json:"channel"`
+	Destination            string     `json:"destination"`
+	Teller_Id              *int64     `json:"teller_id"`
+	Reference              string     `json:"reference"`
+	Transaction_History_Id int64      `json:"transaction_history_id"`
+	Failure_Reason         string     `json:"failure_reason"`
+	Settled_By             *int64     `json:"settled_by"`
+	Time_Stamp             time.Time  `json:"time_stamp"`
+	Settled_At             *time.Time `json:"settled_at"`
+}
+
+func (Withdrawal) TableName() string {
+	return "withdrawal"
+}
@@ -0,0 +1,364 @@
+// Package outbox delivers calls to the deposit service reliably. A message is
+// written in the same database transaction as the local records it belongs
+// to, and the Relay keeps delivering it until the service accepts or rejects
+// it, so the two systems cannot drift apart when a commit or a call fails.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"final-project/deposit"
+	"final-project/httpclient"
+	model "final-project/models"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const EventDepositCreate = "deposit.create"
+
+const (
+	maxAttempts = 10
+	maxBackoff  = time.Hour
+	batchSize   = 50
+	// sendLease is how long a message may stay sending before it counts as
+	// interrupted. It must be well above the deposit client's timeout.
+	sendLease = 5 * time.Minute
+)
+
+// Enqueue writes a pending message inside tx. dedupKey is unique, so the same
+// logical call can never be queued twice.
+func Enqueue(tx *gorm.DB, eventType string, aggregateId int64, dedupKey string, payload interface{}) (*model.Outbox, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	entry := model.Outbox{
+		Event_Type:      eventType,
+		Aggregate_Id:    aggregateId,
+		Dedup_Key:       dedupKey,
+		Payload:         string(data),
+		Status:          model.OutboxStatusPending,
+		Next_Attempt_At: now,
+		Time_Stamp:      now,
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		return nil, err
+	}
+
+	return &entry, nil
+}
+
+type Relay struct {
+	db       *gorm.DB
+	deposit  deposit.Service
+	interval time.Duration
+}
+
+func NewRelay(db *gorm.DB, depositService deposit.Service, interval time.Duration) *Relay {
+	return &Relay{
+		db,
+		depositService,
+		interval,
+	}
+}
+
+// Start delivers due messages on every interval until ctx is cancelled.
+func (r *Relay) Start(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.RunOnce(ctx); err != nil {
+			log.Printf("outbox relay: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce tries every pending message whose next attempt is due, and every
+// sending message whose lease ran out.
+func (r *Relay) RunOnce(ctx context.Context) error {
+	var ids []int64
+	if err := r.db.Model(&model.Outbox{}).Where("status IN ? AND next_attempt_at <= ?", []string{model.OutboxStatusPending, model.OutboxStatusSending}, time.Now()).Order("id").Limit(batchSize).Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if _, err := r.Deliver(ctx, id); err != nil {
+			log.Printf("outbox relay: outbox %d: %v", id, err)
+		}
+	}
+
+	return nil
+}
+
+// Deliver makes one attempt at a due message and returns its resulting
+// status. The message is claimed and marked sending in one transaction, the
+// service is called with no transaction open, and the result is recorded in
+// another, so a slow service holds neither a connection nor row locks. The
+// sending mark is a lease: the relay and a request delivering the same
+// message inline never both send it, and a message whose lease ran out is
+// treated as interrupted mid-call. A message that is not due, or is being
+// sent by someone else, is skipped and reported as pending.
+func (r *Relay) Deliver(ctx context.Context, id int64) (*model.Outbox, error) {
+	entry, interrupted, err := r.claim(id)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return &model.Outbox{Id: id, Status: model.OutboxStatusPending}, nil
+	}
+
+	contractId, sendErr := r.send(ctx, entry, interrupted)
+
+	tx := r.db.Begin()
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	// Someone else took the message over after the lease ran out; their
+	// attempt reconciles with the service, so this result is dropped.
+	claimed := entry.Attempts
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(entry, id).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if entry.Status != model.OutboxStatusSending || entry.Attempts != claimed {
+		tx.Rollback()
+		return entry, sendErr
+	}
+
+	if sendErr == nil {
+		sendErr = r.confirm(tx, entry, contractId)
+	}
+	now := time.Now()
+
+	var uncertain *uncertainError
+	switch {
+	case sendErr == nil:
+		entry.Status = model.OutboxStatusSent
+		entry.Sent_At = &now
+		entry.Last_Error = ""
+	case permanent(sendErr):
+		entry.Status = model.OutboxStatusFailed
+		entry.Last_Error = sendErr.Error()
+		if err := r.reject(tx, entry); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	case errors.As(sendErr, &uncertain) && !r.canReconcile():
+		// The service may have booked the deposit and cannot be asked, so
+		// sending again could book it twice. Someone has to check and replay.
+		entry.Status = model.OutboxStatusFailed
+		entry.Last_Error = "outcome unknown, check the deposit service before replaying: " + sendErr.Error()
+	default:
+		entry.Status = model.OutboxStatusPending
+		entry.Last_Error = sendErr.Error()
+		entry.Next_Attempt_At = now.Add(backoff(entry.Attempts))
+		if entry.Attempts >= maxAttempts {
+			// The call may have reached the service before timing out, so
+			// the reservation is kept until someone replays or releases it.
+			entry.Status = model.OutboxStatusFailed
+		}
+	}
+
+	// If this fails the message stays sending until the lease runs out and
+	// the next attempt reconciles with the service.
+	if err := tx.Save(entry).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	return entry, sendErr
+}
+
+// claim marks a due message as sending and counts the attempt. It reports
+// whether the previous attempt was interrupted while calling the service.
+func (r *Relay) claim(id int64) (*model.Outbox, bool, error) {
+	var entry *model.Outbox
+	interrupted := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		found := model.Outbox{}
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("id = ? AND status IN ? AND next_attempt_at <= ?", id, []string{model.OutboxStatusPending, model.OutboxStatusSending}, time.Now()).
+			First(&found).Error
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return nil
+			}
+			return err
+		}
+
+		interrupted = found.Status == model.OutboxStatusSending
+		found.Status = model.OutboxStatusSending
+		found.Attempts++
+		found.Next_Attempt_At = time.Now().Add(sendLease)
+		if err := tx.Save(&found).Error; err != nil {
+			return err
+		}
+		entry = &found
+		return nil
+	})
+	return entry, interrupted, err
+}
+
+// errInterrupted is reported for a message whose previous attempt stopped
+// mid-call on a service that cannot be asked how it ended.
+var errInterrupted = errors.New("previous attempt was interrupted")
+
+// send calls the service for a claimed message and returns the contract it
+// booked. It runs with no transaction open.
+func (r *Relay) send(ctx context.Context, entry *model.Outbox, interrupted bool) (string, error) {
+	switch entry.Event_Type {
+	case EventDepositCreate:
+		var req deposit.Request
+		if err := json.Unmarshal([]byte(entry.Payload), &req); err != nil {
+			return "", err
+		}
+
+		// An earlier attempt may have reached the service, so look the
+		// registration up before sending it again.
+		if entry.Attempts > 1 && r.canReconcile() {
+			contract, err := r.deposit.(deposit.Finder).FindByReference(ctx, req.Reference)
+			if err != nil {
+				return "", err
+			}
+			if contract != nil {
+				return contract.ContractID, nil
+			}
+		} else if interrupted {
+			return "", &uncertainError{errInterrupted}
+		}
+
+		contract, err := r.deposit.Create(ctx, req)
+		if err != nil {
+			if errors.Is(err, httpclient.ErrCircuitOpen) {
+				return "", err
+			}
+			return "", &uncertainError{err}
+		}
+		return contract.ContractID, nil
+	default:
+		return "", fmt.Errorf("unknown event type %q", entry.Event_Type)
+	}
+}
+
+// confirm records a booked contract locally inside tx.
+func (r *Relay) confirm(tx *gorm.DB, entry *model.Outbox, contractId string) error {
+	switch entry.Event_Type {
+	case EventDepositCreate:
+		var depositHistory model.DepositHistory
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&depositHistory, entry.Aggregate_Id).Error; err != nil {
+			return err
+		}
+		return deposit.Confirm(tx, &depositHistory, contractId)
+	default:
+		return nil
+	}
+}
+
+// canReconcile reports whether the service can say if a registration was
+// booked, which makes resending after an unclear failure safe.
+func (r *Relay) canReconcile() bool {
+	_, ok := r.deposit.(deposit.Finder)
+	return ok
+}
+
+// uncertainError marks a failure after the call may have reached the
+// service, so the deposit may or may not have been booked.
+type uncertainError struct {
+	err error
+}
+
+func (e *uncertainError) Error() string {
+	return e.err.Error()
+}
+
+func (e *uncertainError) Unwrap() error {
+	return e.err
+}
+
+// reject undoes the local side of a message the service refused.
+func (r *Relay) reject(tx *gorm.DB, entry *model.Outbox) error {
+	switch entry.Event_Type {
+	case EventDepositCreate:
+		var depositHistory model.DepositHistory
+		if err := tx.First(&depositHistory, entry.Aggregate_Id).Error; err != nil {
+			return err
+		}
+		return deposit.Release(tx, &depositHistory)
+	default:
+		return nil
+	}
+}
+
+var ErrNotReplayable = errors.New("outbox message cannot be replayed")
+
+// Replay puts a failed message back in the queue. A deposit registration is
+// only replayed while its funds are still reserved; once they were released
+// the user has their money back and booking the contract would be wrong.
+func Replay(db *gorm.DB, id int64) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		entry := model.Outbox{}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ? AND status = ?", id, model.OutboxStatusFailed).First(&entry).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return ErrNotReplayable
+			}
+			return err
+		}
+
+		if entry.Event_Type == EventDepositCreate {
+			var depositHistory model.DepositHistory
+			if err := tx.First(&depositHistory, entry.Aggregate_Id).Error; err != nil {
+				return err
+			}
+			if depositHistory.Status != model.DepositStatusReserved {
+				return ErrNotReplayable
+			}
+		}
+
+		return tx.Model(&entry).Updates(map[string]interface{}{
+			"status":          model.OutboxStatusPending,
+			"attempts":        0,
+			"next_attempt_at": time.Now(),
+		}).Error
+	})
+}
+
+// permanent reports whether retrying cannot help: the service answered and
+// refused the request. Transport errors and ambiguous answers are never
+// permanent, because the deposit may already be booked.
+func permanent(err error) bool {
+	var apiErr *deposit.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Rejected()
+	}
+	return errors.Is(err, deposit.ErrProductNotFound) || errors.Is(err, deposit.ErrNotReserved)
+}
+
+func backoff(attempts int) time.Duration {
+	delay := 10 * time.Second << (attempts - 1)
+	if delay <= 0 || delay > maxBackoff {
+		return maxBackoff
+	}
+	return delay
+}
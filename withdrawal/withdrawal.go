@@ -0,0 +1,182 @@
+// Package withdrawal takes money out of user wallets.
+//
+// A withdrawal debits the wallet right away into a clearing account and stays
+// pending until the payout is settled. Completing it moves the money from
+// clearing to cash; failing it returns the money to the wallet. Over-the-
+// counter withdrawals by a teller are completed in the same transaction.
+package withdrawal
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"final-project/ledger"
+	"final-project/limits"
+	model "final-project/models"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Categories used for both the transaction history and the journal entry.
+const (
+	Category         = "Withdrawal"
+	SettledCategory  = Category + "Settled"
+	ReversalCategory = Category + "Reversal"
+)
+
+var (
+	ErrInsufficientBalance = errors.New("insufficient balance")
+	ErrLimitExceeded       = errors.New("amount exceeds the per-transaction withdrawal limit")
+	ErrUserNotFound        = errors.New("user not found")
+	ErrNotPending          = errors.New("withdrawal is not pending")
+)
+
+// Request describes a withdrawal to open.
+type Request struct {
+	Account_Id  int64
+	Amount      int64
+	Channel     string
+	Destination string
+	Teller_Id   *int64
+}
+
+// Create locks the wallet, checks the balance and the per-transaction limit,
+// and debits the amount into the clearing account. maxAmount of zero means
+// no limit. It must run inside the caller's transaction.
+func Create(tx *gorm.DB, request Request, maxAmount int64) (*model.Withdrawal, error) {
+	if maxAmount > 0 && request.Amount > maxAmount {
+		return nil, ErrLimitExceeded
+	}
+
+	var user model.User
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("account_id = ?", request.Account_Id).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	if err := limits.Check(tx, request.Account_Id, request.Amount); err != nil {
+		return nil, err
+	}
+
+	if user.Balance < request.Amount {
+		return nil, ErrInsufficientBalance
+	}
+
+	reference, err := newReference()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	history := model.TransactionHistory{
+		Account_Id:           request.Account_Id,
+		Transaction_Category: Category,
+		Amount:               request.Amount,
+		In_Out:               1,
+		Reference:            reference,
+		Time_Stamp:           now,
+	}
+	if err := tx.Create(&history).Error; err != nil {
+		return nil, err
+	}
+
+	if _, err := ledger.Post(tx, Category, reference,
+		ledger.User(request.Account_Id, -request.Amount),
+		ledger.Internal(ledger.WithdrawalAccount, request.Amount),
+	); err != nil {
+		return nil, err
+	}
+
+	withdrawal := model.Withdrawal{
+		Account_Id:             request.Account_Id,
+		Amount:                 request.Amount,
+		Status:                 model.WithdrawalPending,
+		Channel:                request.Channel,
+		Destination:            request.Destination,
+		Teller_Id:              request.Teller_Id,
+		Reference:              reference,
+		Transaction_History_Id: history.Id,
+		Time_Stamp:             now,
+	}
+	if err := tx.Create(&withdrawal).Error; err != nil {
+		return nil, err
+	}
+
+	return &withdrawal, nil
+}
+
+// Lock loads a withdrawal for settlement under a row lock.
+func Lock(tx *gorm.DB, id interface{}) (*model.Withdrawal, error) {
+	var withdrawal model.Withdrawal
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&withdrawal, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &withdrawal, nil
+}
+
+// Complete records that the payout left the bank.
+func Complete(tx *gorm.DB, withdrawal *model.Withdrawal, settledBy *int64) error {
+	if withdrawal.Status != model.WithdrawalPending {
+		return ErrNotPending
+	}
+
+	if _, err := ledger.Post(tx, SettledCategory, withdrawal.Reference,
+		ledger.Internal(ledger.WithdrawalAccount, -withdrawal.Amount),
+		ledger.Internal(ledger.CashAccount, withdrawal.Amount),
+	); err != nil {
+		return err
+	}
+
+	return settle(tx, withdrawal, model.WithdrawalCompleted, settledBy, "")
+}
+
+// Fail records that the payout did not go through and credits the amount
+// back to the wallet with a matching history row.
+func Fail(tx *gorm.DB, withdrawal *model.Withdrawal, settledBy *int64, reason string) error {
+	if withdrawal.Status != model.WithdrawalPending {
+		return ErrNotPending
+	}
+
+	history := model.TransactionHistory{
+		Account_Id:           withdrawal.Account_Id,
+		Transaction_Category: ReversalCategory,
+		Amount:               withdrawal.Amount,
+		In_Out:               0,
+		Reference:            withdrawal.Reference,
+		Time_Stamp:           time.Now(),
+	}
+	if err := tx.Create(&history).Error; err != nil {
+		return err
+	}
+
+	if _, err := ledger.Post(tx, ReversalCategory, withdrawal.Reference,
+		ledger.Internal(ledger.WithdrawalAccount, -withdrawal.Amount),
+		ledger.User(withdrawal.Account_Id, withdrawal.Amount),
+	); err != nil {
+		return err
+	}
+
+	return settle(tx, withdrawal, model.WithdrawalFailed, settledBy, reason)
+}
+
+func settle(tx *gorm.DB, withdrawal *model.Withdrawal, status string, settledBy *int64, reason string) error {
+	now := time.Now()
+	withdrawal.Status = status
+	withdrawal.Settled_By = settledBy
+	withdrawal.Failure_Reason = reason
+	withdrawal.Settled_At = &now
+	return tx.Save(withdrawal).Error
+}
+
+func newReference() (string, error) {
+	buf := make([]byte, 6)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "WDR" + strings.ToUpper(hex.EncodeToString(buf)), nil
+}